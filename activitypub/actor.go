@@ -0,0 +1,129 @@
+// Package activitypub resolves WebFinger handles to ActivityPub actors.
+//
+// Following this spec: https://www.w3.org/TR/activitypub/#actor-objects
+package activitypub
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ant0ine/go-webfinger"
+	"github.com/ant0ine/go-webfinger/jrd"
+)
+
+// ContentType is the media type of ActivityStreams documents.
+const ContentType = "application/activity+json"
+
+// ldContentType is the JSON-LD media type of ActivityStreams documents.
+const ldContentType = `application/ld+json; profile="https://www.w3.org/ns/activitystreams"`
+
+// Actor is an ActivityPub actor, limited to the properties needed to address
+// and authenticate it.
+type Actor struct {
+	ID                string    `json:"id"`
+	Type              string    `json:"type,omitempty"`
+	Inbox             string    `json:"inbox,omitempty"`
+	Outbox            string    `json:"outbox,omitempty"`
+	PreferredUsername string    `json:"preferredUsername,omitempty"`
+	Name              string    `json:"name,omitempty"`
+	PublicKey         PublicKey `json:"publicKey"`
+}
+
+// PublicKey is the public key of an actor, as published by most ActivityPub
+// servers for HTTP Signatures.
+type PublicKey struct {
+	ID           string `json:"id,omitempty"`
+	Owner        string `json:"owner,omitempty"`
+	PublicKeyPem string `json:"publicKeyPem,omitempty"`
+}
+
+// Parse decodes the PEM encoded public key.
+func (k *PublicKey) Parse() (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(k.PublicKeyPem))
+	if block == nil {
+		return nil, errors.New("activitypub: no PEM data in public key")
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// Resolve looks up identifier (e.g. "alice@example.com") with c, and fetches
+// the actor its self link points to.
+func Resolve(c *webfinger.Client, identifier string) (*Actor, error) {
+	resourceJRD, err := c.Lookup(identifier, []string{jrd.RelSelf})
+	if err != nil {
+		return nil, err
+	}
+
+	actorURL, err := resourceJRD.ActivityPubActor()
+	if err != nil {
+		return nil, fmt.Errorf("activitypub: no actor for %s: %v", identifier, err)
+	}
+
+	return FetchActor(c, actorURL.String())
+}
+
+// FetchActor fetches and parses the actor at actorURL, using the HTTP client
+// of c.  The id of the actor must have the same scheme and host as the URL the
+// actor was served from, so that a server cannot claim actors of other
+// domains.
+func FetchActor(c *webfinger.Client, actorURL string) (*Actor, error) {
+	req, err := http.NewRequest("GET", actorURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", ContentType+", "+ldContentType)
+
+	log.Printf("GET %s", actorURL)
+	res, err := c.HTTPClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if !(200 <= res.StatusCode && res.StatusCode < 300) {
+		return nil, errors.New(res.Status)
+	}
+
+	if ct := res.Header.Get("content-type"); !jrd.IsActivityStreamsType(ct) && !strings.Contains(strings.ToLower(ct), "application/json") {
+		return nil, fmt.Errorf("invalid content-type: %s", ct)
+	}
+
+	content, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	actor := Actor{}
+	if err := json.Unmarshal(content, &actor); err != nil {
+		return nil, err
+	}
+	if actor.ID == "" {
+		return nil, errors.New("activitypub: actor has no id")
+	}
+	if err := checkID(actor.ID, res.Request.URL); err != nil {
+		return nil, err
+	}
+	return &actor, nil
+}
+
+// checkID returns an error if id is not an absolute URL with the same origin
+// as the URL the actor was fetched from.
+func checkID(id string, fetched *url.URL) error {
+	u, err := url.Parse(id)
+	if err != nil || !u.IsAbs() {
+		return fmt.Errorf("activitypub: actor id %q is not an absolute URL", id)
+	}
+	if !strings.EqualFold(u.Scheme, fetched.Scheme) || !strings.EqualFold(u.Host, fetched.Host) {
+		return fmt.Errorf("activitypub: actor id %s does not match %s", id, fetched)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package activitypub
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ant0ine/go-webfinger"
+)
+
+func TestResolve(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	keyPem := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	mux := http.NewServeMux()
+	server := httptest.NewTLSServer(mux)
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+
+	actorURL := server.URL + "/users/bob"
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprintf(w, `{
+			"subject": "acct:bob@%s",
+			"links": [
+				{"rel": "self", "type": "text/html", "href": "%s/@bob"},
+				{"rel": "self", "type": "application/activity+json", "href": %q}
+			]
+		}`, u.Host, server.URL, actorURL)
+	})
+	mux.HandleFunc("/users/bob", func(w http.ResponseWriter, r *http.Request) {
+		if accept := r.Header.Get("Accept"); !strings.Contains(accept, ContentType) {
+			t.Errorf("Accept header is %q, want %q", accept, ContentType)
+		}
+		w.Header().Add("content-type", ContentType)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"@context":          "https://www.w3.org/ns/activitystreams",
+			"id":                actorURL,
+			"type":              "Person",
+			"inbox":             actorURL + "/inbox",
+			"outbox":            actorURL + "/outbox",
+			"preferredUsername": "bob",
+			"publicKey": map[string]string{
+				"id":           actorURL + "#main-key",
+				"owner":        actorURL,
+				"publicKeyPem": keyPem,
+			},
+		})
+	})
+
+	client := webfinger.NewClient(&http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	})
+
+	actor, err := Resolve(client, "bob@"+u.Host)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := &Actor{
+		ID:                actorURL,
+		Type:              "Person",
+		Inbox:             actorURL + "/inbox",
+		Outbox:            actorURL + "/outbox",
+		PreferredUsername: "bob",
+		PublicKey: PublicKey{
+			ID:           actorURL + "#main-key",
+			Owner:        actorURL,
+			PublicKeyPem: keyPem,
+		},
+	}
+	if !reflect.DeepEqual(actor, want) {
+		t.Errorf("Resolve returned %#v, want %#v", actor, want)
+	}
+
+	pub, err := actor.PublicKey.Parse()
+	if err != nil {
+		t.Fatalf("Unexpected error parsing public key: %v", err)
+	}
+	if !reflect.DeepEqual(pub, &key.PublicKey) {
+		t.Errorf("PublicKey.Parse returned %#v, want %#v", pub, &key.PublicKey)
+	}
+}
+
+func TestFetchActor_idMismatch(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", ContentType)
+		fmt.Fprint(w, `{"id": "https://victim.example/users/alice", "type": "Person"}`)
+	}))
+	defer server.Close()
+
+	client := webfinger.NewClient(server.Client())
+	if _, err := FetchActor(client, server.URL+"/users/alice"); err == nil {
+		t.Error("FetchActor accepted an actor whose id is on another host")
+	}
+}
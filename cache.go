@@ -0,0 +1,538 @@
+package webfinger
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ant0ine/go-webfinger/jrd"
+)
+
+// A FailureClass classifies failed lookups, to cache them for different
+// times.
+type FailureClass string
+
+const (
+	// FailureNotFound means the host answered that the resource does not
+	// exist (404 or 410).
+	FailureNotFound FailureClass = "not-found"
+
+	// FailureNoHost means the host of the resource does not exist
+	// (NXDOMAIN).
+	FailureNoHost FailureClass = "no-host"
+
+	// FailureUnreachable means no connection could be established with the
+	// host (connection refused, for example).
+	FailureUnreachable FailureClass = "unreachable"
+)
+
+// DefaultNegativeTTL are the times failed lookups are cached for, by failure
+// class, when the NegativeTTL of a Client is nil.
+var DefaultNegativeTTL = map[FailureClass]time.Duration{
+	FailureNotFound:    5 * time.Minute,
+	FailureNoHost:      10 * time.Minute,
+	FailureUnreachable: time.Minute,
+}
+
+// A CacheEntry is the cached outcome of a lookup: either a Result, or a failure
+// for negative entries.
+type CacheEntry struct {
+	// Result is the result of the lookup, nil for negative entries.
+	Result *Result
+
+	// Failure and Message are the class and message of the error of negative
+	// entries.
+	Failure FailureClass
+	Message string
+
+	// Stored is the time the entry was stored, and Expires the time it stops
+	// being fresh.
+	Stored  time.Time
+	Expires time.Time
+
+	// StaleWhileRevalidate and StaleIfError are the times a successful
+	// lookup may be used after it expires, while it is refreshed in the
+	// background, and when refreshing it fails.
+	StaleWhileRevalidate time.Duration
+	StaleIfError         time.Duration
+}
+
+// A Cache stores the outcome of lookups.  Caches may keep entries past their
+// expiry, and must be safe for concurrent use.
+type Cache interface {
+	// Get returns the entry stored for key, if any.
+	Get(key string) (*CacheEntry, bool)
+
+	// Set stores entry for key.
+	Set(key string, entry *CacheEntry)
+}
+
+// A NegativeCacheError is returned when a lookup failure is served from the
+// cache.
+type NegativeCacheError struct {
+	Resource string
+	Failure  FailureClass
+
+	// Message is the message of the original error.
+	Message string
+
+	// Expires is the time the entry expires.
+	Expires time.Time
+}
+
+func (e *NegativeCacheError) Error() string {
+	return fmt.Sprintf("%s (cached %s failure for %s)", e.Message, e.Failure, e.Resource)
+}
+
+// A StatusError is returned when a JRD is served with a non-2xx status.
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return e.Status
+}
+
+// MemoryCache is a Cache keeping entries in memory.
+type MemoryCache struct {
+	// MaxEntries is the maximum number of entries kept.  When reached, the
+	// entries expiring first are evicted.  Zero means no limit.
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+	expiry  expiryHeap
+}
+
+// memoryEntry is an entry of a MemoryCache, with its index in the expiry heap.
+type memoryEntry struct {
+	key   string
+	entry *CacheEntry
+	index int
+}
+
+// expiryHeap is a min-heap of the entries of a MemoryCache by expiry time.
+type expiryHeap []*memoryEntry
+
+func (h expiryHeap) Len() int { return len(h) }
+
+func (h expiryHeap) Less(i, j int) bool { return h[i].entry.Expires.Before(h[j].entry.Expires) }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x interface{}) {
+	e := x.(*memoryEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return e
+}
+
+// NewMemoryCache returns a new MemoryCache holding at most maxEntries entries,
+// or an unlimited number if maxEntries is zero.
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	return &MemoryCache{MaxEntries: maxEntries}
+}
+
+// Get implements Cache.
+func (m *MemoryCache) Get(key string) (*CacheEntry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	return e.entry, true
+}
+
+// Set implements Cache.
+func (m *MemoryCache) Set(key string, entry *CacheEntry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.entries == nil {
+		m.entries = map[string]*memoryEntry{}
+	}
+	if e, ok := m.entries[key]; ok {
+		e.entry = entry
+		heap.Fix(&m.expiry, e.index)
+	} else {
+		e = &memoryEntry{key: key, entry: entry}
+		heap.Push(&m.expiry, e)
+		m.entries[key] = e
+	}
+
+	for m.MaxEntries > 0 && len(m.entries) > m.MaxEntries {
+		e := heap.Pop(&m.expiry).(*memoryEntry)
+		delete(m.entries, e.key)
+	}
+}
+
+// cacheKey returns the key of the lookup of resource for rels.  The scheme and
+// host of resource are case-insensitive, and lower-cased so that the lookups
+// of equivalent resources share their entry.
+func cacheKey(resource *Resource, rels []string) string {
+	r := *resource
+	r.Scheme = strings.ToLower(r.Scheme)
+	r.Host = strings.ToLower(r.Host)
+	if r.Scheme == "acct" || r.Scheme == "mailto" {
+		if i := strings.LastIndex(r.Opaque, "@"); i >= 0 {
+			r.Opaque = r.Opaque[:i] + strings.ToLower(r.Opaque[i:])
+		}
+	}
+
+	sorted := append([]string(nil), rels...)
+	sort.Strings(sorted)
+	return r.String() + " " + strings.Join(sorted, " ")
+}
+
+// freshness tells how long a response may be cached.
+type freshness struct {
+	TTL                  time.Duration
+	StaleWhileRevalidate time.Duration
+	StaleIfError         time.Duration
+}
+
+// cacheFreshness returns how long a response with header h may be cached,
+// from its Cache-Control and Expires headers, or def for what they do not
+// tell.  ok is false if the response must not be cached.
+func cacheFreshness(h http.Header, now time.Time, def freshness) (f freshness, ok bool) {
+	f = def
+	maxAge := false
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		name, value := directive, ""
+		if i := strings.Index(directive, "="); i >= 0 {
+			name, value = directive[:i], strings.Trim(directive[i+1:], `"`)
+		}
+		secs, err := strconv.Atoi(value)
+		d := time.Duration(secs) * time.Second
+
+		switch name {
+		case "no-store", "no-cache":
+			return freshness{}, false
+		case "max-age":
+			if err != nil || secs <= 0 {
+				return freshness{}, false
+			}
+			f.TTL, maxAge = d, true
+		case "stale-while-revalidate":
+			if err == nil && secs >= 0 {
+				f.StaleWhileRevalidate = d
+			}
+		case "stale-if-error":
+			if err == nil && secs >= 0 {
+				f.StaleIfError = d
+			}
+		}
+	}
+	if maxAge {
+		return f, true
+	}
+
+	if expires := h.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil || !t.After(now) {
+			return freshness{}, false
+		}
+		f.TTL = t.Sub(now)
+	}
+	return f, f.TTL > 0
+}
+
+// classifyFailure returns the class of the lookup error err, if it is
+// authoritative enough to be cached.  An error wrapping several errors, such
+// as a *WebFistError, is only cached if all of them are, with the class of the
+// first one.
+func classifyFailure(err error) (FailureClass, bool) {
+	if multi, ok := err.(interface{ Unwrap() []error }); ok {
+		errs := multi.Unwrap()
+		if len(errs) == 0 {
+			return "", false
+		}
+		class, ok := classifyFailure(errs[0])
+		for _, err := range errs[1:] {
+			if _, authoritative := classifyFailure(err); !authoritative {
+				return "", false
+			}
+		}
+		return class, ok
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		if statusErr.StatusCode == http.StatusNotFound || statusErr.StatusCode == http.StatusGone {
+			return FailureNotFound, true
+		}
+		return "", false
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		if dnsErr.IsNotFound {
+			return FailureNoHost, true
+		}
+		return "", false
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" && !opErr.Timeout() {
+		return FailureUnreachable, true
+	}
+	return "", false
+}
+
+// negativeTTL returns the time failures of class are cached for by c.
+func (c *Client) negativeTTL(class FailureClass) time.Duration {
+	if c.NegativeTTL != nil {
+		return c.NegativeTTL[class]
+	}
+	return DefaultNegativeTTL[class]
+}
+
+func (c *Client) now() time.Time {
+	if c.clock != nil {
+		return c.clock()
+	}
+	return time.Now()
+}
+
+// cachedEntry returns the entry stored for key in the cache of c, fresh or
+// not, or nil if there is none.
+func (c *Client) cachedEntry(key string) *CacheEntry {
+	if c.Cache == nil {
+		return nil
+	}
+	entry, ok := c.Cache.Get(key)
+	if !ok {
+		return nil
+	}
+	return entry
+}
+
+// lookup returns the outcome of the lookup of resource stored in e, with the
+// specified cache status.
+func (e *CacheEntry) lookup(resource *Resource, status CacheStatus) (*Result, error) {
+	if e.Result == nil {
+		return nil, &NegativeCacheError{
+			Resource: resource.String(),
+			Failure:  e.Failure,
+			Message:  e.Message,
+			Expires:  e.Expires,
+		}
+	}
+
+	result := copyResult(e.Result)
+	result.CacheStatus = status
+	result.Attempts = nil
+	result.Duration = 0
+	return result, nil
+}
+
+// copyResult returns a copy of r which does not share its JRD, Header and
+// URLs, so that the callers of lookups cannot modify cached results.
+func copyResult(r *Result) *Result {
+	c := *r
+	c.JRD = copyJRD(r.JRD)
+	c.Header = r.Header.Clone()
+	c.QueryURL = copyURL(r.QueryURL)
+	c.FinalURL = copyURL(r.FinalURL)
+	if r.Redirects != nil {
+		c.Redirects = make([]*url.URL, len(r.Redirects))
+		for i, u := range r.Redirects {
+			c.Redirects[i] = copyURL(u)
+		}
+	}
+	return &c
+}
+
+// copyJRD returns a deep copy of j.
+func copyJRD(j *jrd.JRD) *jrd.JRD {
+	if j == nil {
+		return nil
+	}
+	c := *j
+	c.Aliases = append([]string(nil), j.Aliases...)
+	c.Properties = copyProperties(j.Properties)
+	if j.Links != nil {
+		c.Links = make([]jrd.Link, len(j.Links))
+		for i, link := range j.Links {
+			c.Links[i] = link
+			if link.Titles != nil {
+				c.Links[i].Titles = make(map[string]string, len(link.Titles))
+				for lang, title := range link.Titles {
+					c.Links[i].Titles[lang] = title
+				}
+			}
+			c.Links[i].Properties = copyProperties(link.Properties)
+		}
+	}
+	return &c
+}
+
+// copyProperties returns a deep copy of properties, whose values are decoded
+// from JSON.
+func copyProperties(properties map[string]interface{}) map[string]interface{} {
+	if properties == nil {
+		return nil
+	}
+	c := make(map[string]interface{}, len(properties))
+	for name, value := range properties {
+		c[name] = copyJSONValue(value)
+	}
+	return c
+}
+
+func copyJSONValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return copyProperties(v)
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, e := range v {
+			c[i] = copyJSONValue(e)
+		}
+		return c
+	}
+	return v
+}
+
+// storeLookup stores the outcome of the lookup of key in the cache of c: its
+// result, or its final error err if it is authoritative.  The result is
+// copied, so that the caller may modify it.
+func (c *Client) storeLookup(key string, result *Result, err error) {
+	if c.Cache == nil {
+		return
+	}
+
+	now := c.now()
+	entry := &CacheEntry{Stored: now}
+	if err == nil {
+		f, ok := cacheFreshness(result.Header, now, freshness{
+			TTL:                  c.CacheTTL,
+			StaleWhileRevalidate: c.StaleWhileRevalidate,
+			StaleIfError:         c.StaleIfError,
+		})
+		if !ok {
+			return
+		}
+		entry.Result = copyResult(result)
+		entry.Expires = now.Add(f.TTL)
+		entry.StaleWhileRevalidate = f.StaleWhileRevalidate
+		entry.StaleIfError = f.StaleIfError
+	} else {
+		class, ok := classifyFailure(err)
+		if !ok {
+			return
+		}
+		ttl := c.negativeTTL(class)
+		if ttl <= 0 {
+			return
+		}
+		entry.Failure = class
+		entry.Message = err.Error()
+		entry.Expires = now.Add(ttl)
+	}
+	c.Cache.Set(key, entry)
+}
+
+// refresher runs the background refreshes of the cache entries of a Client.
+// It is shared by the copies of the Client.
+type refresher struct {
+	mu     sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+	closed bool
+
+	// refreshing holds the keys of the lookups being refreshed.
+	refreshing map[string]bool
+	wg         sync.WaitGroup
+}
+
+// start runs refresh in the background for key, with a context canceled by
+// close, unless key is already being refreshed.  It returns false if r is
+// closed.
+func (r *refresher) start(key string, refresh func(ctx context.Context)) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return false
+	}
+	if r.refreshing[key] {
+		return true
+	}
+	if r.ctx == nil {
+		r.ctx, r.cancel = context.WithCancel(context.Background())
+		r.refreshing = map[string]bool{}
+	}
+	r.refreshing[key] = true
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer func() {
+			r.mu.Lock()
+			delete(r.refreshing, key)
+			r.mu.Unlock()
+		}()
+		refresh(r.ctx)
+	}()
+	return true
+}
+
+// close cancels the refreshes in progress, waits for them to return, and
+// prevents new ones.
+func (r *refresher) close() {
+	r.mu.Lock()
+	r.closed = true
+	if r.cancel != nil {
+		r.cancel()
+	}
+	r.mu.Unlock()
+	r.wg.Wait()
+}
+
+// revalidate refreshes the lookup of key in the background, unless it is
+// already being refreshed.  stale is the entry currently cached.  It returns
+// false if c cannot refresh in the background.
+func (c *Client) revalidate(key string, resource *Resource, rels []string, stale *CacheEntry) bool {
+	if c.refresher == nil {
+		return false
+	}
+	return c.refresher.start(key, func(ctx context.Context) {
+		if _, err := c.fetchResource(ctx, key, resource, rels, stale); err != nil {
+			log.Printf("Cannot refresh WebFinger data for %s: %v", resource, err)
+		}
+	})
+}
+
+// Close cancels the background refreshes of the cache entries of c, and
+// waits for them to return.  Lookups of expired entries then fetch them again
+// instead of refreshing them in the background.  Close applies to the copies
+// of c as well.
+func (c *Client) Close() error {
+	if c.refresher != nil {
+		c.refresher.close()
+	}
+	return nil
+}
@@ -0,0 +1,387 @@
+package webfinger
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	setup()
+	defer teardown()
+
+	requests := 0
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.FormValue("resource") != "acct:bob@"+testHost {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Add("content-type", "application/jrd+json")
+		w.Header().Add("cache-control", "public, max-age=60")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	})
+
+	now := time.Now()
+	client.clock = func() time.Time { return now }
+	client.Cache = NewMemoryCache(0)
+	client.WebFistServer = ""
+	client.NegativeTTL = map[FailureClass]time.Duration{FailureNotFound: 30 * time.Second}
+
+	lookup := func(identifier string) (*Result, error) {
+		return client.LookupWithInfo(identifier+"@"+testHost, nil)
+	}
+
+	result, err := lookup("bob")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.CacheStatus != CacheMiss {
+		t.Errorf("CacheStatus is %q, want %q", result.CacheStatus, CacheMiss)
+	}
+	result, err = lookup("bob")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.CacheStatus != CacheHit || result.JRD.Subject != "bob@example.com" {
+		t.Errorf("Cached lookup returned %+v, want a hit", result)
+	}
+
+	_, err = lookup("alice")
+	var negErr *NegativeCacheError
+	if err == nil || errors.As(err, &negErr) {
+		t.Errorf("First failed lookup returned error %v, want a fresh error", err)
+	}
+	_, err = lookup("alice")
+	if !errors.As(err, &negErr) {
+		t.Fatalf("Second failed lookup returned error %v, want a *NegativeCacheError", err)
+	}
+	if negErr.Failure != FailureNotFound {
+		t.Errorf("Failure class is %q, want %q", negErr.Failure, FailureNotFound)
+	}
+	if got, want := requests, 2; got != want {
+		t.Errorf("Server received %d requests, want %d", got, want)
+	}
+
+	// the negative entry expires before the positive one
+	now = now.Add(45 * time.Second)
+	lookup("bob")
+	lookup("alice")
+	if got, want := requests, 3; got != want {
+		t.Errorf("Server received %d requests, want %d", got, want)
+	}
+
+	now = now.Add(time.Minute)
+	lookup("bob")
+	if got, want := requests, 4; got != want {
+		t.Errorf("Server received %d requests, want %d", got, want)
+	}
+}
+
+func TestCacheFreshness(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	def := freshness{TTL: time.Minute, StaleIfError: time.Hour}
+	tests := []struct {
+		header http.Header
+		want   freshness
+		ok     bool
+	}{
+		{http.Header{"Cache-Control": {"max-age=300"}}, freshness{5 * time.Minute, 0, time.Hour}, true},
+		{http.Header{"Cache-Control": {"no-store"}}, freshness{}, false},
+		{http.Header{"Cache-Control": {"max-age=0"}}, freshness{}, false},
+		{http.Header{"Expires": {now.Add(time.Hour).Format(http.TimeFormat)}}, freshness{time.Hour, 0, time.Hour}, true},
+		{http.Header{}, def, true},
+		{
+			http.Header{"Cache-Control": {"max-age=60, stale-while-revalidate=30, stale-if-error=86400"}},
+			freshness{time.Minute, 30 * time.Second, 24 * time.Hour},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		f, ok := cacheFreshness(tt.header, now, def)
+		if f != tt.want || ok != tt.ok {
+			t.Errorf("cacheFreshness(%v) returned (%+v, %v), want (%+v, %v)", tt.header, f, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCache_stale(t *testing.T) {
+	setup()
+	defer teardown()
+
+	requests := 0
+	fail := false
+	refreshed := make(chan bool, 10)
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if fail {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Add("content-type", "application/jrd+json")
+		w.Header().Add("cache-control", "max-age=60, stale-while-revalidate=60")
+		fmt.Fprintf(w, `{"subject":"bob@example.com","aliases":["%d"]}`, requests)
+		refreshed <- true
+	})
+
+	now := time.Now()
+	client.clock = func() time.Time { return now }
+	client.Cache = NewMemoryCache(0)
+	client.StaleIfError = time.Hour
+	client.WebFistServer = ""
+
+	lookup := func() *Result {
+		result, err := client.LookupWithInfo("bob@"+testHost, nil)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return result
+	}
+
+	lookup()
+	<-refreshed
+
+	// stale while revalidating: the stale JRD is returned, and a single
+	// refresh is issued
+	now = now.Add(90 * time.Second)
+	for i := 0; i < 3; i++ {
+		result := lookup()
+		if result.CacheStatus != CacheStale || result.JRD.Aliases[0] != "1" {
+			t.Errorf("Lookup returned %s JRD %v, want the stale one", result.CacheStatus, result.JRD.Aliases)
+		}
+	}
+	client.refresher.wg.Wait()
+	if got, want := requests, 2; got != want {
+		t.Errorf("Server received %d requests, want %d", got, want)
+	}
+	if result := lookup(); result.CacheStatus != CacheHit || result.JRD.Aliases[0] != "2" {
+		t.Errorf("Lookup returned %s JRD %v, want the refreshed one", result.CacheStatus, result.JRD.Aliases)
+	}
+
+	// stale if error
+	fail = true
+	now = now.Add(30 * time.Minute)
+	result := lookup()
+	if result.CacheStatus != CacheStaleIfError || result.JRD.Aliases[0] != "2" {
+		t.Errorf("Lookup returned %s JRD %v, want the stale one", result.CacheStatus, result.JRD.Aliases)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, err := client.Lookup("bob@"+testHost, nil); err == nil {
+		t.Error("Expected error once stale-if-error is over")
+	}
+}
+
+func TestClassifyFailure(t *testing.T) {
+	tests := []struct {
+		err   error
+		class FailureClass
+		ok    bool
+	}{
+		{&StatusError{404, "404 Not Found"}, FailureNotFound, true},
+		{&StatusError{500, "500 Internal Server Error"}, "", false},
+		{&net.OpError{Op: "dial", Err: &net.DNSError{IsNotFound: true}}, FailureNoHost, true},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, FailureUnreachable, true},
+		{errors.New("invalid content-type"), "", false},
+	}
+	for _, tt := range tests {
+		class, ok := classifyFailure(tt.err)
+		if class != tt.class || ok != tt.ok {
+			t.Errorf("classifyFailure(%v) returned (%q, %v), want (%q, %v)", tt.err, class, ok, tt.class, tt.ok)
+		}
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"acct:bob@Example.COM", "acct:bob@example.com", true},
+		{"ACCT:bob@example.com", "acct:bob@example.com", true},
+		{"https://Example.com/bob", "https://example.com/bob", true},
+		{"acct:Bob@example.com", "acct:bob@example.com", false},
+		{"https://example.com/Bob", "https://example.com/bob", false},
+	}
+	for _, tt := range tests {
+		a, _ := Parse(tt.a)
+		b, _ := Parse(tt.b)
+		if same := cacheKey(a, nil) == cacheKey(b, nil); same != tt.same {
+			t.Errorf("Keys of %s and %s are the same: %v, want %v", tt.a, tt.b, same, tt.same)
+		}
+	}
+}
+
+func TestMemoryCache_eviction(t *testing.T) {
+	m := NewMemoryCache(2)
+	now := time.Now()
+	m.Set("a", &CacheEntry{Expires: now.Add(time.Minute)})
+	m.Set("b", &CacheEntry{Expires: now.Add(time.Second)})
+	m.Set("c", &CacheEntry{Expires: now.Add(time.Hour)})
+
+	if _, ok := m.Get("b"); ok {
+		t.Error("Entry expiring first was not evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := m.Get(key); !ok {
+			t.Errorf("Entry %q was evicted", key)
+		}
+	}
+
+	// replacing an entry updates its expiry
+	m.Set("c", &CacheEntry{Expires: now.Add(time.Second)})
+	m.Set("d", &CacheEntry{Expires: now.Add(time.Hour)})
+	if _, ok := m.Get("c"); ok {
+		t.Error("Replaced entry expiring first was not evicted")
+	}
+	for _, key := range []string{"a", "d"} {
+		if _, ok := m.Get(key); !ok {
+			t.Errorf("Entry %q was evicted", key)
+		}
+	}
+}
+
+func TestCache_copy(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		w.Header().Add("cache-control", "max-age=60")
+		fmt.Fprint(w, `{"subject":"acct:bob@example.com","links":[{"rel":"self","properties":{"p":"v"}}]}`)
+	})
+	client.Cache = NewMemoryCache(0)
+	client.WebFistServer = ""
+
+	j, err := client.Lookup("acct:bob@"+testHost, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	j.Subject = "modified"
+	j.Links[0].Properties["p"] = "modified"
+
+	for i := 0; i < 2; i++ {
+		result, err := client.LookupWithInfo("acct:bob@"+testHost, nil)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result.CacheStatus != CacheHit {
+			t.Errorf("CacheStatus is %q, want %q", result.CacheStatus, CacheHit)
+		}
+		if result.JRD.Subject != "acct:bob@example.com" || result.JRD.Links[0].GetProperty("p") != "v" {
+			t.Errorf("Cached JRD was modified: %+v", result.JRD)
+		}
+		if result.QueryURL.Host != testHost {
+			t.Errorf("Cached QueryURL was modified: %v", result.QueryURL)
+		}
+		result.JRD.Links[0].Properties["p"] = "modified"
+		result.QueryURL.Host = "modified"
+	}
+}
+
+func TestCache_webfistFailure(t *testing.T) {
+	setup()
+	defer teardown()
+
+	// the host of the resource and the WebFist server are the same, the
+	// host answers the first query of each lookup with originStatus, and
+	// WebFist the second one with 404
+	requests := 0
+	originStatus := http.StatusServiceUnavailable
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests%2 == 1 {
+			http.Error(w, "origin", originStatus)
+			return
+		}
+		http.NotFound(w, r)
+	})
+	client.Cache = NewMemoryCache(0)
+	client.WebFistServer = testHost
+	client.NegativeTTL = map[FailureClass]time.Duration{FailureNotFound: time.Minute}
+
+	var negErr *NegativeCacheError
+	for i := 0; i < 2; i++ {
+		_, err := client.Lookup("acct:bob@"+testHost, nil)
+		if err == nil || errors.As(err, &negErr) {
+			t.Errorf("Lookup returned error %v, want a fresh error", err)
+		}
+	}
+
+	originStatus = http.StatusNotFound
+	_, err := client.Lookup("acct:alice@"+testHost, nil)
+	if err == nil || errors.As(err, &negErr) {
+		t.Errorf("Lookup returned error %v, want a fresh error", err)
+	}
+	_, err = client.Lookup("acct:alice@"+testHost, nil)
+	if !errors.As(err, &negErr) {
+		t.Fatalf("Lookup returned error %v, want a *NegativeCacheError", err)
+	}
+	if negErr.Failure != FailureNotFound {
+		t.Errorf("Failure class is %q, want %q", negErr.Failure, FailureNotFound)
+	}
+	if got, want := requests, 6; got != want {
+		t.Errorf("Server received %d requests, want %d", got, want)
+	}
+}
+
+func TestClient_Close(t *testing.T) {
+	setup()
+	defer teardown()
+
+	requests := 0
+	refreshing := make(chan bool)
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 2 {
+			// the background refresh hangs until canceled
+			close(refreshing)
+			<-r.Context().Done()
+			return
+		}
+		w.Header().Add("content-type", "application/jrd+json")
+		w.Header().Add("cache-control", "max-age=60, stale-while-revalidate=60")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	})
+
+	now := time.Now()
+	client.clock = func() time.Time { return now }
+	client.Cache = NewMemoryCache(0)
+	client.WebFistServer = ""
+
+	lookup := func() *Result {
+		result, err := client.LookupWithInfo("acct:bob@"+testHost, nil)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return result
+	}
+	lookup()
+	now = now.Add(90 * time.Second)
+	if result := lookup(); result.CacheStatus != CacheStale {
+		t.Errorf("Lookup returned %s JRD, want a stale one", result.CacheStatus)
+	}
+	<-refreshing
+
+	closed := make(chan bool)
+	go func() {
+		client.Close()
+		closed <- true
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not cancel the background refresh")
+	}
+
+	// once closed, expired entries are fetched by lookups
+	if result := lookup(); result.CacheStatus != CacheMiss {
+		t.Errorf("Lookup after Close returned %s JRD, want %s", result.CacheStatus, CacheMiss)
+	}
+	if got, want := requests, 3; got != want {
+		t.Errorf("Server received %d requests, want %d", got, want)
+	}
+}
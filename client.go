@@ -37,14 +37,16 @@
 package webfinger
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
+	"github.com/ant0ine/go-webfinger/dkim"
 	"github.com/ant0ine/go-webfinger/jrd"
 )
 
@@ -55,17 +57,19 @@ type Resource url.URL
 // absolute URL, or an email-like identifier (e.g. "bob@example.com").
 func Parse(rawurl string) (*Resource, error) {
 	u, err := url.Parse(rawurl)
-	if err != nil {
-		return nil, err
-	}
 
 	// if parsed URL has no scheme but is email-like, treat it as an acct: URL.
-	if u.Scheme == "" {
-		parts := strings.SplitN(rawurl, "@", 2)
-		if len(parts) != 2 {
-			return nil, fmt.Errorf("URL must be absolute, or an email address: %v", rawurl)
+	// url.Parse rejects email-like identifiers with a port (e.g.
+	// "bob@example.com:8080"), so those are handled here as well.
+	if err != nil || u.Scheme == "" {
+		at, colon := strings.Index(rawurl, "@"), strings.Index(rawurl, ":")
+		if at > 0 && (colon < 0 || at < colon) {
+			return Parse("acct:" + rawurl)
+		}
+		if err != nil {
+			return nil, err
 		}
-		return Parse("acct:" + rawurl)
+		return nil, fmt.Errorf("URL must be absolute, or an email address: %v", rawurl)
 	}
 
 	r := Resource(*u)
@@ -107,7 +111,7 @@ func (r *Resource) JRDURL(host string, rels []string) *url.URL {
 	return &url.URL{
 		Scheme: "https",
 		Host:   host,
-		Path:   "/.well-known/webfinger",
+		Path:   wellKnownPath,
 		RawQuery: url.Values{
 			"resource": []string{r.String()},
 			"rel":      rels,
@@ -123,17 +127,119 @@ type Client struct {
 	// WebFistServer is the host used for issuing WebFist queries when standard
 	// WebFinger lookup fails.  If set to the empty string, queries will not fall
 	// back to the WebFist protocol.
+	//
+	// WebFistServer is ignored if WebFistServers is set.
 	WebFistServer string
 
+	// WebFistServers are the hosts used for issuing WebFist queries when
+	// standard WebFinger lookup fails.  They are tried in order, or
+	// concurrently if WebFistParallel is set, and the first successful
+	// response is used.
+	WebFistServers []string
+
+	// WebFistParallel queries all WebFistServers concurrently instead of in
+	// order.
+	WebFistParallel bool
+
+	// WebFistTimeout bounds the time spent on each WebFist server, including
+	// fetching the delegation proof and the delegated JRD.  Zero means no
+	// timeout.
+	WebFistTimeout time.Duration
+
+	// DisableWebFist disables the fallback to the WebFist protocol, whatever
+	// the WebFist servers configured.
+	DisableWebFist bool
+
+	// SchemePolicy decides which schemes are used to issue WebFinger queries.
+	// If nil, HTTPSOnly is used, or HTTPSThenHTTP if AllowHTTP is set.
+	SchemePolicy SchemePolicy
+
 	// Allow the use of HTTP endoints for lookups.  The WebFinger spec requires
 	// all lookups be performed over HTTPS, so this should only ever be enabled
 	// for development.
+	//
+	// AllowHTTP is ignored if SchemePolicy is set.
 	AllowHTTP bool
+
+	// HostResolver maps the hosts of resources to the endpoints their
+	// WebFinger queries are issued at.  If nil, queries are issued at
+	// /.well-known/webfinger on the host of the resource.
+	HostResolver HostResolver
+
+	// Instrumentation receives the events of lookups, for tracing and
+	// metrics.  If nil, lookups are not instrumented.
+	Instrumentation Instrumentation
+
+	// RedirectPolicy restricts the redirects followed by WebFinger queries.
+	// Violations are reported as a *RedirectError.
+	RedirectPolicy RedirectPolicy
+
+	// Middleware wraps the transport of the HTTP client, in order: the first
+	// one sees requests first.  It applies to all the requests of the Client,
+	// including WebFist ones.
+	Middleware []Middleware
+
+	// UserAgent is the User-Agent of requests which have none once through
+	// Middleware: Middleware do not see it, and may set their own.  If
+	// empty, DefaultUserAgent is used.
+	UserAgent string
+
+	// Cache stores the outcome of lookups.  If nil, lookups are not cached.
+	//
+	// Successful lookups are cached for the time allowed by the
+	// Cache-Control or Expires headers of the response, or CacheTTL if they
+	// have none.  Failed lookups are cached for the NegativeTTL of their
+	// FailureClass, and are then returned as a *NegativeCacheError.
+	Cache Cache
+
+	// CacheTTL is the time successful lookups are cached for, when the
+	// response does not tell.  Zero means such lookups are not cached.
+	CacheTTL time.Duration
+
+	// NegativeTTL are the times failed lookups are cached for, by failure
+	// class.  Classes without a TTL are not cached.  If nil,
+	// DefaultNegativeTTL is used.
+	NegativeTTL map[FailureClass]time.Duration
+
+	// StaleWhileRevalidate is the time successful lookups are served from
+	// the cache after they expire, while they are refreshed in the
+	// background, unless the response tells otherwise with the
+	// stale-while-revalidate Cache-Control directive.
+	StaleWhileRevalidate time.Duration
+
+	// StaleIfError is the time successful lookups are served from the cache
+	// after they expire, when refreshing them fails, unless the response
+	// tells otherwise with the stale-if-error Cache-Control directive.
+	StaleIfError time.Duration
+
+	// clock returns the current time, for tests.
+	clock func() time.Time
+
+	// refresher runs the background refreshes of cache entries.
+	refresher *refresher
+
+	// DKIMResolver looks up the DKIM keys used to verify WebFist delegation
+	// proofs.  If nil, net.DefaultResolver is used.
+	DKIMResolver dkim.TXTResolver
+
+	// KeySource provides the keys used to verify signed JRDs.  When set, the
+	// signature of any signed JRD is verified, and lookups fail if it is
+	// invalid.
+	KeySource KeySource
+
+	// RequireSignatureOverHTTP requires JRDs fetched over plain HTTP to carry
+	// a valid signature from a key provided by KeySource.
+	RequireSignatureOverHTTP bool
+
+	// RequireSignatureForWebFist requires JRDs delegated through the WebFist
+	// protocol to carry a valid signature from a key provided by KeySource.
+	RequireSignatureForWebFist bool
 }
 
 // DefaultClient is the default Client and is used by Lookup.
 var DefaultClient = &Client{
 	client:        http.DefaultClient,
+	refresher:     new(refresher),
 	WebFistServer: webFistDefaultServer,
 }
 
@@ -153,10 +259,19 @@ func NewClient(httpClient *http.Client) *Client {
 	}
 	return &Client{
 		client:        httpClient,
+		refresher:     new(refresher),
 		WebFistServer: webFistDefaultServer,
 	}
 }
 
+// HTTPClient returns the HTTP client used by c to perform lookups, with its
+// Middleware, UserAgent and RedirectPolicy, so that related requests (fetching
+// documents linked from a JRD, for example) share its configuration.  The
+// returned client reflects the configuration of c at the time of the call.
+func (c *Client) HTTPClient() *http.Client {
+	return c.httpClient()
+}
+
 // Lookup returns the JRD for the specified identifier.  If provided, only the
 // specified rel values will be requested, though WebFinger servers are not
 // obligated to respect that request.
@@ -173,69 +288,214 @@ func (c *Client) Lookup(identifier string, rels []string) (*jrd.JRD, error) {
 // only the specified rel values will be requested, though WebFinger servers
 // are not obligated to respect that request.
 func (c *Client) LookupResource(resource *Resource, rels []string) (*jrd.JRD, error) {
+	result, err := c.lookupResource(context.Background(), resource, rels)
+	if err != nil {
+		return nil, err
+	}
+	return result.JRD, nil
+}
+
+func (c *Client) lookupResource(ctx context.Context, resource *Resource, rels []string) (result *Result, err error) {
 	log.Printf("Looking up WebFinger data for %s", resource)
 
-	resourceJRD, err := c.fetchJRD(resource.JRDURL("", rels))
+	ctx, end := c.instrumentation().StartLookup(ctx, resource)
+	defer func() { end(result, err) }()
+
+	key := cacheKey(resource, rels)
+	entry := c.cachedEntry(key)
+	if entry != nil {
+		switch now := c.now(); {
+		case now.Before(entry.Expires):
+			log.Printf("Using cached WebFinger data for %s", resource)
+			return entry.lookup(resource, CacheHit)
+		case entry.Result != nil && now.Before(entry.Expires.Add(entry.StaleWhileRevalidate)):
+			// once c is closed, entries are refreshed by lookups instead
+			if c.revalidate(key, resource, rels, entry) {
+				log.Printf("Using stale WebFinger data for %s while revalidating", resource)
+				return entry.lookup(resource, CacheStale)
+			}
+		}
+	}
+
+	return c.fetchResource(ctx, key, resource, rels, entry)
+}
+
+// fetchResource looks up resource on the network, and caches the outcome
+// under key.  If the lookup fails while the stale entry can still be used in
+// place of errors, the stale entry is returned and kept in the cache.
+func (c *Client) fetchResource(ctx context.Context, key string, resource *Resource, rels []string, stale *CacheEntry) (*Result, error) {
+	start := time.Now()
+	rec := &recorder{}
+	ctx = withRecorder(ctx, rec)
+
+	jrdURL, pinned, err := c.queryURL(ctx, resource, rels)
+	if err != nil {
+		return nil, err
+	}
+
+	strategy := StrategyWebFinger
+	var fetched *fetchResult
+	if pinned {
+		fetched, err = c.fetchURL(ctx, jrdURL, resource.WebFingerHost(), false)
+	} else {
+		fetched, err = c.fetchJRD(ctx, jrdURL, resource.WebFingerHost(), false)
+	}
 	if err != nil {
 		log.Print(err)
+		_, authoritative := classifyFailure(err)
 
 		// Fallback to WebFist protocol
-		if c.WebFistServer != "" {
+		if servers := c.webfistServers(); len(servers) > 0 {
 			log.Print("Falling back to WebFist protocol")
-			resourceJRD, err = c.webfistLookup(resource)
+			strategy = StrategyWebFist
+			fetched, err = c.webfistFallback(ctx, resource, servers)
 		}
 
 		if err != nil {
+			if stale != nil && stale.Result != nil && c.now().Before(stale.Expires.Add(stale.StaleIfError)) {
+				log.Printf("Using stale WebFinger data for %s: %v", resource, err)
+				return stale.lookup(resource, CacheStaleIfError)
+			}
+			// a failure of WebFist is not cached if the resource host
+			// itself might have answered
+			if authoritative {
+				c.storeLookup(key, nil, err)
+			}
 			return nil, err
 		}
 	}
 
-	return resourceJRD, nil
+	result := newResult(fetched, strategy, rec, time.Since(start))
+	c.storeLookup(key, result, nil)
+	return result, nil
 }
 
-func (c *Client) fetchJRD(jrdURL *url.URL) (*jrd.JRD, error) {
-	// TODO verify signature if not https
-	// TODO extract http cache info
+// fetchResult is the outcome of fetching a JRD.
+type fetchResult struct {
+	JRD *jrd.JRD
 
-	// Get follows up to 10 redirects
-	log.Printf("GET %s", jrdURL.String())
-	res, err := c.client.Get(jrdURL.String())
-	if err != nil {
-		errString := strings.ToLower(err.Error())
-		// For some crazy reason, App Engine returns a "ssl_certificate_error" when
-		// unable to connect to an HTTPS URL, so we check for that as well here.
-		if (strings.Contains(errString, "connection refused") ||
-			strings.Contains(errString, "ssl_certificate_error")) && c.AllowHTTP {
-			jrdURL.Scheme = "http"
-			log.Printf("GET %s", jrdURL.String())
-			res, err = c.client.Get(jrdURL.String())
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			return nil, err
+	// URL is the URL the JRD was requested at, with the scheme actually used.
+	URL *url.URL
+
+	// FinalURL is the URL that served the JRD, after redirects.
+	FinalURL *url.URL
+
+	// Redirects are the URLs redirected to, in order.
+	Redirects []*url.URL
+
+	StatusCode int
+	Header     http.Header
+
+	// WebFistServer is the WebFist server that delegated the JRD, if any.
+	WebFistServer string
+}
+
+// fetchJRD fetches and parses the WebFinger query jrdURL, using the schemes
+// allowed by the SchemePolicy of c.  jrdURL is not modified.  See fetchURL for
+// signer and requireSignature.
+func (c *Client) fetchJRD(ctx context.Context, jrdURL *url.URL, signer string, requireSignature bool) (*fetchResult, error) {
+	schemes := c.schemePolicy().Schemes(jrdURL.Host)
+	if len(schemes) == 0 {
+		return nil, fmt.Errorf("no scheme allowed for %s", jrdURL.Host)
+	}
+
+	var err error
+	for i, scheme := range schemes {
+		u := *jrdURL
+		u.Scheme = scheme
+
+		var result *fetchResult
+		result, err = c.fetchURL(ctx, &u, signer, requireSignature)
+		if err == nil || !isConnectError(err) {
+			return result, err
+		}
+		if i < len(schemes)-1 {
+			log.Printf("Cannot connect over %s, retrying over %s: %v", scheme, schemes[i+1], err)
 		}
 	}
+	return nil, err
+}
 
-	if !(200 <= res.StatusCode && res.StatusCode < 300) {
-		return nil, errors.New(res.Status)
+// fetchURL fetches and parses the JRD at jrdURL.  If requireSignature is true,
+// or if the JRD is served over plain HTTP and c.RequireSignatureOverHTTP is
+// set, the JRD must be signed.  Signatures are verified with the keys of
+// signer, the host trusted to describe the resource, whatever the host the JRD
+// is finally served from.
+func (c *Client) fetchURL(ctx context.Context, jrdURL *url.URL, signer string, requireSignature bool) (*fetchResult, error) {
+	ctx, end := c.instrumentation().StartFetch(ctx, jrdURL)
+	start := time.Now()
+	attempt := Attempt{URL: jrdURL}
+	defer func() {
+		attempt.Duration = time.Since(start)
+		recordAttempt(ctx, attempt)
+		end(attempt)
+	}()
+
+	// Get follows redirects allowed by c.RedirectPolicy
+	log.Printf("GET %s", jrdURL.String())
+	res, err := c.get(ctx, jrdURL.String())
+	if err != nil {
+		attempt.Err = err
+		return nil, err
 	}
+	attempt.StatusCode = res.StatusCode
 
 	content, err := ioutil.ReadAll(res.Body)
 	res.Body.Close()
 	if err != nil {
+		attempt.Err = err
 		return nil, err
 	}
 
+	if !(200 <= res.StatusCode && res.StatusCode < 300) {
+		attempt.Err = &StatusError{StatusCode: res.StatusCode, Status: res.Status}
+		return nil, attempt.Err
+	}
+
 	ct := strings.ToLower(res.Header.Get("content-type"))
 	if strings.Contains(ct, "application/jrd+json") ||
 		strings.Contains(ct, "application/json") {
+		required := requireSignature ||
+			(c.RequireSignatureOverHTTP && res.Request.URL.Scheme == "http")
+		if err := c.verifySignature(ctx, res, content, signer, required); err != nil {
+			attempt.Err = err
+			return nil, err
+		}
+
 		parsed, err := jrd.ParseJRD(content)
 		if err != nil {
+			attempt.Err = err
 			return nil, err
 		}
-		return parsed, nil
+		return &fetchResult{
+			JRD:        parsed,
+			URL:        jrdURL,
+			FinalURL:   res.Request.URL,
+			Redirects:  redirects(res),
+			StatusCode: res.StatusCode,
+			Header:     res.Header,
+		}, nil
+	}
+
+	attempt.Err = fmt.Errorf("invalid content-type: %s", ct)
+	return nil, attempt.Err
+}
+
+// redirects returns the URLs res was redirected to before reaching its final
+// URL, in order, including the final URL.
+func redirects(res *http.Response) []*url.URL {
+	var urls []*url.URL
+	for req := res.Request; req != nil && req.Response != nil; req = req.Response.Request {
+		urls = append([]*url.URL{req.URL}, urls...)
 	}
+	return urls
+}
 
-	return nil, fmt.Errorf("invalid content-type: %s", ct)
+// get issues a GET request for rawurl, bound to ctx.
+func (c *Client) get(ctx context.Context, rawurl string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.httpClient().Do(req.WithContext(ctx))
 }
@@ -66,6 +66,16 @@ func TestResource_Parse(t *testing.T) {
 	if !reflect.DeepEqual(r, want) {
 		t.Errorf("Parsed resource: %#v, want %#v", r, want)
 	}
+
+	// email-like identifier with a port, which url.Parse rejects
+	r, err = Parse("bob@example.com:8080")
+	if err != nil {
+		t.Errorf("Unexpected error: %#v", err)
+	}
+	want = &Resource{Scheme: "acct", Opaque: "bob@example.com:8080"}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("Parsed resource: %#v, want %#v", r, want)
+	}
 }
 
 func TestResource_Parse_error(t *testing.T) {
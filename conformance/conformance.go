@@ -0,0 +1,390 @@
+// Package conformance checks that WebFinger servers follow RFC 7033.
+//
+// Checks are run against a base URL and produce a Report.  The conformancetest
+// package runs them against an http.Handler, and reports the failed checks as
+// test errors.
+//
+// Following this spec: http://tools.ietf.org/html/rfc7033
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ant0ine/go-webfinger/jrd"
+)
+
+const (
+	// webfingerPath is the path of WebFinger queries.
+	webfingerPath = "/.well-known/webfinger"
+
+	// maxRedirects is the number of redirects followed by queries.
+	maxRedirects = 10
+)
+
+// A Status is the outcome of a check.
+type Status string
+
+const (
+	Pass Status = "pass"
+
+	// Warn means the server does not follow a recommendation (SHOULD) of
+	// the spec.
+	Warn Status = "warn"
+
+	// Fail means the server does not follow a requirement (MUST) of the
+	// spec.
+	Fail Status = "fail"
+
+	// Skip means the check could not be run.
+	Skip Status = "skip"
+)
+
+// A Result is the outcome of a check.
+type Result struct {
+	// ID identifies the check, e.g. "cors".
+	ID string `json:"id"`
+
+	// Description describes what is checked.
+	Description string `json:"description"`
+
+	Status Status `json:"status"`
+
+	// Message explains the status, if not Pass.
+	Message string `json:"message,omitempty"`
+}
+
+// A Report is the outcome of the checks of a server.
+type Report struct {
+	// Target is the base URL of the server checked.
+	Target string `json:"target"`
+
+	Results []Result `json:"results"`
+}
+
+// OK reports whether no check failed.
+func (r *Report) OK() bool {
+	for _, result := range r.Results {
+		if result.Status == Fail {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats the report as a table, one check per line.
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "WebFinger conformance of %s\n", r.Target)
+	for _, result := range r.Results {
+		fmt.Fprintf(&b, "  %-4s  %-18s %s", strings.ToUpper(string(result.Status)), result.ID, result.Description)
+		if result.Message != "" {
+			fmt.Fprintf(&b, ": %s", result.Message)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// Options configure the checks.
+type Options struct {
+	// Resource is a resource known by the server, e.g.
+	// "acct:bob@example.com".  It is required.
+	Resource string
+
+	// UnknownResource is a resource unknown by the server.  If empty, an
+	// acct: resource unlikely to exist on the host of the server is used.
+	UnknownResource string
+
+	// Rel is the rel used to check link filtering.  If empty, the rel of the
+	// first link of Resource is used.
+	Rel string
+
+	// Client is the HTTP client used.  If nil, http.DefaultClient is used.
+	// Its redirect policy is ignored: redirects to HTTPS are followed and
+	// checked, and the checks run on the final response.
+	Client *http.Client
+}
+
+// Check runs the checks against the WebFinger server at baseURL, e.g.
+// "https://example.com".  An error is returned if the checks cannot be run at
+// all.
+func Check(ctx context.Context, baseURL string, opts Options) (*Report, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if base.Host == "" {
+		return nil, fmt.Errorf("base URL %q has no host", baseURL)
+	}
+	if opts.Resource == "" {
+		return nil, errors.New("no resource to query")
+	}
+
+	c := &checker{ctx: ctx, base: base, opts: opts}
+	c.client = &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	if opts.Client != nil {
+		c.client.Transport = opts.Client.Transport
+		c.client.Jar = opts.Client.Jar
+		c.client.Timeout = opts.Client.Timeout
+	}
+	if c.opts.UnknownResource == "" {
+		c.opts.UnknownResource = "acct:conformance-unknown-7033@" + base.Hostname()
+	}
+
+	c.run()
+	return &Report{Target: base.String(), Results: c.results}, nil
+}
+
+// checker runs the checks.
+type checker struct {
+	ctx     context.Context
+	base    *url.URL
+	opts    Options
+	client  *http.Client
+	results []Result
+}
+
+// response is a response to a query, with its body.
+type response struct {
+	*http.Response
+	body []byte
+
+	// redirects are the URLs the query was redirected to, in order.
+	redirects []*url.URL
+}
+
+func (c *checker) add(id, description string, status Status, format string, args ...interface{}) {
+	c.results = append(c.results, Result{
+		ID:          id,
+		Description: description,
+		Status:      status,
+		Message:     fmt.Sprintf(format, args...),
+	})
+}
+
+func (c *checker) pass(id, description string) {
+	c.results = append(c.results, Result{ID: id, Description: description, Status: Pass})
+}
+
+// query issues a WebFinger query with the specified parameters, following
+// the redirects to HTTPS URLs.  The response of a redirect which is not
+// followed is returned as is.
+func (c *checker) query(params url.Values) (*response, error) {
+	u := *c.base
+	u.Path = strings.TrimSuffix(u.Path, "/") + webfingerPath
+	u.RawQuery = params.Encode()
+
+	var redirects []*url.URL
+	for next := &u; ; {
+		res, err := c.get(next)
+		if err != nil {
+			return nil, err
+		}
+		res.redirects = redirects
+		if !isRedirect(res.StatusCode) {
+			return res, nil
+		}
+		loc, err := res.Location()
+		if err != nil || loc.Scheme != "https" || len(redirects) == maxRedirects {
+			return res, nil
+		}
+		redirects = append(redirects, loc)
+		next = loc
+	}
+}
+
+// get fetches u, without following redirects.
+func (c *checker) get(u *url.URL) (*response, error) {
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/jrd+json")
+	res, err := c.client.Do(req.WithContext(c.ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &response{Response: res, body: body}, nil
+}
+
+func isRedirect(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+func (c *checker) run() {
+	const httpsDesc = "server is queried over HTTPS (4.)"
+	if c.base.Scheme == "https" {
+		c.pass("https", httpsDesc)
+	} else {
+		c.add("https", httpsDesc, Fail, "base URL scheme is %q", c.base.Scheme)
+	}
+
+	res, err := c.query(url.Values{"resource": {c.opts.Resource}})
+	if err != nil {
+		c.add("query", "known resource can be queried", Fail, "%v", err)
+		return
+	}
+	c.checkRedirect(res)
+	if res.StatusCode != http.StatusOK {
+		c.add("query", "known resource can be queried", Fail, "status %s", res.Status)
+		return
+	}
+	c.pass("query", "known resource can be queried")
+
+	c.checkCORS(res)
+	c.checkContentType(res)
+	known := c.checkJRD(res)
+	c.checkMissingResource()
+	c.checkUnknownResource()
+	c.checkRelFilter(known)
+}
+
+// checkRedirect checks the redirects of res, all of which were followed
+// unless res is a redirect itself.
+func (c *checker) checkRedirect(res *response) {
+	const desc = "redirects stay on HTTPS (4.2)"
+	if !isRedirect(res.StatusCode) {
+		c.pass("redirect", desc)
+		return
+	}
+	loc, err := res.Location()
+	switch {
+	case err != nil:
+		c.add("redirect", desc, Fail, "redirect without a valid Location: %v", err)
+	case loc.Scheme != "https":
+		c.add("redirect", desc, Fail, "redirects to %s", loc)
+	default:
+		c.add("redirect", desc, Fail, "more than %d redirects", maxRedirects)
+	}
+}
+
+func (c *checker) checkCORS(res *response) {
+	const desc = "Access-Control-Allow-Origin is * (5.)"
+	switch origin := res.Header.Get("Access-Control-Allow-Origin"); origin {
+	case "*":
+		c.pass("cors", desc)
+	case "":
+		c.add("cors", desc, Fail, "header missing")
+	default:
+		c.add("cors", desc, Warn, "header is %q", origin)
+	}
+}
+
+func (c *checker) checkContentType(res *response) {
+	const desc = "Content-Type is application/jrd+json (4.2)"
+	ct := res.Header.Get("Content-Type")
+	if strings.HasPrefix(strings.ToLower(ct), "application/jrd+json") {
+		c.pass("content-type", desc)
+	} else {
+		c.add("content-type", desc, Fail, "Content-Type is %q", ct)
+	}
+}
+
+// checkJRD checks the JRD of the known resource, and returns it if it can be
+// parsed.
+func (c *checker) checkJRD(res *response) *jrd.JRD {
+	const desc = "response is a valid JRD (4.4)"
+	j, err := jrd.ParseJRD(res.body)
+	if err != nil {
+		c.add("jrd", desc, Fail, "%v", err)
+		return nil
+	}
+	if err := j.Validate(); err != nil {
+		c.add("jrd", desc, Fail, "%v", err)
+		return j
+	}
+	c.pass("jrd", desc)
+
+	const subjectDesc = "subject or aliases match the resource (4.4.1)"
+	if j.Subject == c.opts.Resource {
+		c.pass("subject", subjectDesc)
+		return j
+	}
+	for _, alias := range j.Aliases {
+		if alias == c.opts.Resource {
+			c.pass("subject", subjectDesc)
+			return j
+		}
+	}
+	c.add("subject", subjectDesc, Warn, "subject is %q", j.Subject)
+	return j
+}
+
+func (c *checker) checkMissingResource() {
+	const desc = "missing resource parameter returns 400 (4.2)"
+	res, err := c.query(url.Values{})
+	switch {
+	case err != nil:
+		c.add("missing-resource", desc, Fail, "%v", err)
+	case res.StatusCode != http.StatusBadRequest:
+		c.add("missing-resource", desc, Fail, "status %s", res.Status)
+	default:
+		c.pass("missing-resource", desc)
+	}
+}
+
+func (c *checker) checkUnknownResource() {
+	const desc = "unknown resource returns 404 (4.2)"
+	res, err := c.query(url.Values{"resource": {c.opts.UnknownResource}})
+	switch {
+	case err != nil:
+		c.add("unknown-resource", desc, Fail, "%v", err)
+	case res.StatusCode != http.StatusNotFound:
+		c.add("unknown-resource", desc, Fail, "status %s for %s", res.Status, c.opts.UnknownResource)
+	default:
+		c.pass("unknown-resource", desc)
+	}
+}
+
+func (c *checker) checkRelFilter(known *jrd.JRD) {
+	const desc = "rel parameter filters links (4.3)"
+	rel := c.opts.Rel
+	if rel == "" && known != nil && len(known.Links) > 0 {
+		rel = known.Links[0].Rel
+	}
+	if rel == "" {
+		c.add("rel-filter", desc, Skip, "no rel to filter with")
+		return
+	}
+
+	res, err := c.query(url.Values{"resource": {c.opts.Resource}, "rel": {rel}})
+	if err != nil {
+		c.add("rel-filter", desc, Fail, "%v", err)
+		return
+	}
+	if res.StatusCode != http.StatusOK {
+		c.add("rel-filter", desc, Fail, "status %s", res.Status)
+		return
+	}
+	j, err := jrd.ParseJRD(res.body)
+	if err != nil {
+		c.add("rel-filter", desc, Fail, "%v", err)
+		return
+	}
+	for _, link := range j.Links {
+		if link.Rel != rel {
+			// servers may ignore the rel parameter
+			c.add("rel-filter", desc, Warn, "link with rel %q returned when filtering on %q", link.Rel, rel)
+			return
+		}
+	}
+	c.pass("rel-filter", desc)
+}
@@ -0,0 +1,117 @@
+package conformance
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ant0ine/go-webfinger/jrd"
+	"github.com/ant0ine/go-webfinger/server"
+)
+
+var bob = &jrd.JRD{
+	Subject: "acct:bob@example.com",
+	Links: []jrd.Link{
+		{Rel: jrd.RelProfilePage, Href: "https://example.com/@bob"},
+		{Rel: jrd.RelAvatar, Href: "https://example.com/bob.png"},
+	},
+}
+
+// checkHandler runs the checks against h, served over HTTPS by a test server.
+func checkHandler(t *testing.T, h http.Handler, opts Options) *Report {
+	s := httptest.NewTLSServer(h)
+	defer s.Close()
+
+	opts.Client = s.Client()
+	report, err := Check(context.Background(), s.URL, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func TestCheck(t *testing.T) {
+	h := server.NewHandler(server.ResolverFunc(func(r *http.Request, resource string) (*jrd.JRD, error) {
+		if resource == bob.Subject {
+			return bob, nil
+		}
+		return nil, server.ErrNotFound
+	}))
+
+	report := checkHandler(t, h, Options{Resource: bob.Subject})
+	for _, result := range report.Results {
+		if result.Status != Pass {
+			t.Errorf("Check %s returned %s: %s", result.ID, result.Status, result.Message)
+		}
+	}
+}
+
+func TestCheck_broken(t *testing.T) {
+	// a server ignoring the spec
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"subject":"acct:bob@example.com","links":[{"rel":"self","href":"https://example.com/bob"},{"rel":"avatar thing"}]}`)
+	})
+
+	report := checkHandler(t, h, Options{Resource: "acct:bob@example.com"})
+	if report.OK() {
+		t.Errorf("Report is OK, want failures:\n%s", report)
+	}
+
+	want := map[string]Status{
+		"https":            Pass,
+		"redirect":         Pass,
+		"query":            Pass,
+		"cors":             Fail,
+		"content-type":     Fail,
+		"jrd":              Fail,
+		"missing-resource": Fail,
+		"unknown-resource": Fail,
+		"rel-filter":       Warn,
+	}
+	for _, result := range report.Results {
+		if got := result.Status; got != want[result.ID] {
+			t.Errorf("Check %s returned %s, want %s", result.ID, got, want[result.ID])
+		}
+		delete(want, result.ID)
+	}
+	for id := range want {
+		t.Errorf("Check %s was not run", id)
+	}
+}
+
+func TestCheck_redirect(t *testing.T) {
+	h := server.NewHandler(server.ResolverFunc(func(r *http.Request, resource string) (*jrd.JRD, error) {
+		if resource == bob.Subject {
+			return bob, nil
+		}
+		return nil, server.ErrNotFound
+	}))
+	mux := http.NewServeMux()
+	mux.Handle("/wf", h)
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("resource") == "acct:downgrade@example.com" {
+			http.Redirect(w, r, "http://example.com/wf?"+r.URL.RawQuery, http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, "/wf?"+r.URL.RawQuery, http.StatusFound)
+	})
+
+	// the checks run on the response redirected to
+	report := checkHandler(t, mux, Options{Resource: bob.Subject})
+	for _, result := range report.Results {
+		if result.Status != Pass {
+			t.Errorf("Check %s returned %s: %s", result.ID, result.Status, result.Message)
+		}
+	}
+
+	report = checkHandler(t, mux, Options{Resource: "acct:downgrade@example.com"})
+	want := map[string]Status{"redirect": Fail, "query": Fail}
+	for _, result := range report.Results {
+		if want, ok := want[result.ID]; ok && result.Status != want {
+			t.Errorf("Check %s returned %s, want %s", result.ID, result.Status, want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+// Package conformancetest runs the WebFinger conformance checks in Go tests.
+//
+// Example:
+//
+//	func TestConformance(t *testing.T) {
+//		conformancetest.AssertHandler(t, handler, conformance.Options{
+//			Resource: "acct:bob@example.com",
+//		})
+//	}
+package conformancetest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ant0ine/go-webfinger/conformance"
+)
+
+// CheckHandler runs the checks against h, served over HTTPS by a test
+// server.
+func CheckHandler(h http.Handler, opts conformance.Options) *conformance.Report {
+	s := httptest.NewTLSServer(h)
+	defer s.Close()
+
+	opts.Client = s.Client()
+	report, err := conformance.Check(context.Background(), s.URL, opts)
+	if err != nil {
+		return &conformance.Report{Target: s.URL, Results: []conformance.Result{{
+			ID:      "setup",
+			Status:  conformance.Fail,
+			Message: err.Error(),
+		}}}
+	}
+	return report
+}
+
+// AssertHandler runs the checks against h, reporting failed checks as errors
+// of t, and warnings in its log.
+func AssertHandler(t testing.TB, h http.Handler, opts conformance.Options) *conformance.Report {
+	t.Helper()
+	report := CheckHandler(h, opts)
+	assert(t, report)
+	return report
+}
+
+// AssertURL runs the checks against the server at baseURL, reporting failed
+// checks as errors of t, and warnings in its log.
+func AssertURL(t testing.TB, baseURL string, opts conformance.Options) *conformance.Report {
+	t.Helper()
+	report, err := conformance.Check(context.Background(), baseURL, opts)
+	if err != nil {
+		t.Fatalf("Cannot check %s: %v", baseURL, err)
+	}
+	assert(t, report)
+	return report
+}
+
+func assert(t testing.TB, report *conformance.Report) {
+	t.Helper()
+	for _, result := range report.Results {
+		switch result.Status {
+		case conformance.Fail:
+			t.Errorf("%s: %s: %s", result.ID, result.Description, result.Message)
+		case conformance.Warn:
+			t.Logf("%s: %s: %s", result.ID, result.Description, result.Message)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package conformancetest
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ant0ine/go-webfinger/conformance"
+	"github.com/ant0ine/go-webfinger/jrd"
+	"github.com/ant0ine/go-webfinger/server"
+)
+
+func TestAssertHandler(t *testing.T) {
+	bob := &jrd.JRD{
+		Subject: "acct:bob@example.com",
+		Links:   []jrd.Link{{Rel: jrd.RelProfilePage, Href: "https://example.com/@bob"}},
+	}
+	h := server.NewHandler(server.ResolverFunc(func(r *http.Request, resource string) (*jrd.JRD, error) {
+		if resource == bob.Subject {
+			return bob, nil
+		}
+		return nil, server.ErrNotFound
+	}))
+
+	report := AssertHandler(t, h, conformance.Options{Resource: bob.Subject})
+	for _, result := range report.Results {
+		if result.Status != conformance.Pass {
+			t.Errorf("Check %s returned %s: %s", result.ID, result.Status, result.Message)
+		}
+	}
+}
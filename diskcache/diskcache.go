@@ -0,0 +1,407 @@
+// Package diskcache provides a WebFinger client cache persisting lookups on
+// the file system, so that they survive restarts.
+//
+// Example:
+//
+//	cache, err := diskcache.New(filepath.Join(os.Getenv("HOME"), ".cache", "webfinger"), 10<<20)
+//	if err != nil {
+//		panic(err)
+//	}
+//	client := webfinger.NewClient(nil)
+//	client.Cache = cache
+package diskcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ant0ine/go-webfinger"
+	"github.com/ant0ine/go-webfinger/jrd"
+)
+
+const (
+	// ext is the extension of cache files.
+	ext = ".json"
+
+	// tmpPrefix is the prefix of the temporary files entries are written
+	// to before being renamed.
+	tmpPrefix = ".tmp-"
+
+	// tmpMaxAge is the age after which temporary files are considered left
+	// over by a crashed writer.
+	tmpMaxAge = time.Hour
+)
+
+// persistedHeaders are the response headers stored with entries: those
+// telling how long they may be used and how to revalidate them.  Others, such
+// as Set-Cookie, are not written to disk.
+var persistedHeaders = []string{
+	"Cache-Control",
+	"Content-Type",
+	"Date",
+	"Etag",
+	"Expires",
+	"Last-Modified",
+	"Vary",
+}
+
+// Cache is a webfinger.Cache storing each entry in its own file of a
+// directory.  Files are written atomically, so a Cache directory may be shared
+// by concurrent processes.
+//
+// The size of the cache is tracked in memory, from a scan of the directory by
+// New and Sweep, so that each process only accounts for the files it knows of
+// between sweeps.
+type Cache struct {
+	dir      string
+	maxBytes int64
+
+	// mu guards files, size and seq.
+	mu sync.Mutex
+
+	// files are the cache files by name, and size their total size.
+	files map[string]*file
+	size  int64
+
+	// seq orders the writes of files.
+	seq uint64
+}
+
+// file is a cache file, written as the seq-th one.
+type file struct {
+	size int64
+	seq  uint64
+}
+
+var _ webfinger.Cache = (*Cache)(nil)
+
+// New returns a Cache storing its entries in dir, which is created if
+// needed.  When the files of the cache exceed maxBytes, the least recently
+// written ones are evicted.  Zero means no limit.  The directory is swept
+// first, see Sweep.
+func New(dir string, maxBytes int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	c := &Cache{dir: dir, maxBytes: maxBytes}
+	if err := c.Sweep(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Sweep removes the expired entries of the cache, including the time they may
+// be served stale, and the temporary files left over by interrupted writes.
+// It is run by New, and may be run periodically by long-running processes,
+// which also accounts for the files written by other processes.
+func (c *Cache) Sweep() error {
+	c.mu.Lock()
+	start := c.seq
+	c.mu.Unlock()
+
+	infos, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().Before(infos[j].ModTime())
+	})
+	files := map[string]*file{}
+	var size int64
+	for _, info := range infos {
+		name := info.Name()
+		path := filepath.Join(c.dir, name)
+		switch {
+		case info.IsDir():
+		case strings.HasPrefix(name, tmpPrefix):
+			if now.Sub(info.ModTime()) > tmpMaxAge {
+				c.remove(path)
+			}
+		case strings.HasSuffix(name, ext):
+			if expired(path, now) {
+				c.remove(path)
+				continue
+			}
+			files[name] = &file{size: info.Size()}
+			size += info.Size()
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// the files scanned are older than those written since the scan started
+	seq := uint64(0)
+	for _, info := range infos {
+		if f, ok := files[info.Name()]; ok {
+			seq++
+			f.seq = seq
+		}
+	}
+	var written []string
+	for name, f := range c.files {
+		if f.seq > start {
+			written = append(written, name)
+		}
+	}
+	sort.Slice(written, func(i, j int) bool {
+		return c.files[written[i]].seq < c.files[written[j]].seq
+	})
+	for _, name := range written {
+		if old, ok := files[name]; ok {
+			size -= old.size
+		}
+		seq++
+		files[name] = &file{size: c.files[name].size, seq: seq}
+		size += c.files[name].size
+	}
+	c.files, c.size, c.seq = files, size, seq
+	if c.maxBytes > 0 {
+		c.evict()
+	}
+	return nil
+}
+
+// expired tells whether the entry in the file at path can no longer be used.
+// Unreadable entries are expired.
+func expired(path string, now time.Time) bool {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return !os.IsNotExist(err)
+	}
+	var e entry
+	if err := json.Unmarshal(content, &e); err != nil {
+		return true
+	}
+	stale := e.StaleWhileRevalidate
+	if e.StaleIfError > stale {
+		stale = e.StaleIfError
+	}
+	return !now.Before(e.Expires.Add(stale))
+}
+
+func (c *Cache) remove(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Cannot remove cache file: %v", err)
+	}
+}
+
+// entry is the content of cache files.
+type entry struct {
+	Key     string    `json:"key"`
+	Stored  time.Time `json:"stored"`
+	Expires time.Time `json:"expires"`
+
+	StaleWhileRevalidate time.Duration `json:"stale_while_revalidate,omitempty"`
+	StaleIfError         time.Duration `json:"stale_if_error,omitempty"`
+
+	Failure webfinger.FailureClass `json:"failure,omitempty"`
+	Message string                 `json:"message,omitempty"`
+
+	JRD           *jrd.JRD           `json:"jrd,omitempty"`
+	QueryURL      string             `json:"query_url,omitempty"`
+	FinalURL      string             `json:"final_url,omitempty"`
+	Redirects     []string           `json:"redirects,omitempty"`
+	Strategy      webfinger.Strategy `json:"strategy,omitempty"`
+	WebFistServer string             `json:"webfist_server,omitempty"`
+	StatusCode    int                `json:"status_code,omitempty"`
+	Header        http.Header        `json:"header,omitempty"`
+}
+
+// path returns the path of the file of key.
+func (c *Cache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+ext)
+}
+
+// Get implements webfinger.Cache.
+func (c *Cache) Get(key string) (*webfinger.CacheEntry, bool) {
+	content, err := ioutil.ReadFile(c.path(key))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Cannot read cache entry of %s: %v", key, err)
+		}
+		return nil, false
+	}
+
+	var e entry
+	if err := json.Unmarshal(content, &e); err != nil {
+		log.Printf("Cannot decode cache entry of %s: %v", key, err)
+		return nil, false
+	}
+	if e.Key != key {
+		// hash collision
+		return nil, false
+	}
+	return e.cacheEntry(), true
+}
+
+// Set implements webfinger.Cache.
+func (c *Cache) Set(key string, ce *webfinger.CacheEntry) {
+	content, err := json.Marshal(newEntry(key, ce))
+	if err != nil {
+		log.Printf("Cannot encode cache entry of %s: %v", key, err)
+		return
+	}
+	path := c.path(key)
+	if err := c.write(path, content); err != nil {
+		log.Printf("Cannot write cache entry of %s: %v", key, err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	name := filepath.Base(path)
+	if f, ok := c.files[name]; ok {
+		c.size -= f.size
+	}
+	c.seq++
+	c.files[name] = &file{size: int64(len(content)), seq: c.seq}
+	c.size += int64(len(content))
+	if c.maxBytes > 0 {
+		c.evict()
+	}
+}
+
+// write atomically replaces the file at path with content.
+func (c *Cache) write(path string, content []byte) error {
+	f, err := ioutil.TempFile(c.dir, tmpPrefix)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// evict removes the least recently written files until the cache fits in
+// maxBytes.  c.mu must be held.
+func (c *Cache) evict() {
+	if c.size <= c.maxBytes {
+		return
+	}
+
+	names := make([]string, 0, len(c.files))
+	for name := range c.files {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return c.files[names[i]].seq < c.files[names[j]].seq
+	})
+	for _, name := range names {
+		if c.size <= c.maxBytes {
+			break
+		}
+		if err := os.Remove(filepath.Join(c.dir, name)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Cannot evict cache entry: %v", err)
+			continue
+		}
+		c.size -= c.files[name].size
+		delete(c.files, name)
+	}
+}
+
+func newEntry(key string, ce *webfinger.CacheEntry) *entry {
+	e := &entry{
+		Key:                  key,
+		Stored:               ce.Stored,
+		Expires:              ce.Expires,
+		StaleWhileRevalidate: ce.StaleWhileRevalidate,
+		StaleIfError:         ce.StaleIfError,
+		Failure:              ce.Failure,
+		Message:              ce.Message,
+	}
+	if r := ce.Result; r != nil {
+		e.JRD = r.JRD
+		e.QueryURL = urlString(r.QueryURL)
+		e.FinalURL = urlString(r.FinalURL)
+		for _, u := range r.Redirects {
+			e.Redirects = append(e.Redirects, u.String())
+		}
+		e.Strategy = r.Strategy
+		e.WebFistServer = r.WebFistServer
+		e.StatusCode = r.StatusCode
+		for _, name := range persistedHeaders {
+			if values := r.Header.Values(name); len(values) > 0 {
+				if e.Header == nil {
+					e.Header = http.Header{}
+				}
+				e.Header[name] = values
+			}
+		}
+	}
+	return e
+}
+
+func (e *entry) cacheEntry() *webfinger.CacheEntry {
+	ce := &webfinger.CacheEntry{
+		Stored:               e.Stored,
+		Expires:              e.Expires,
+		StaleWhileRevalidate: e.StaleWhileRevalidate,
+		StaleIfError:         e.StaleIfError,
+		Failure:              e.Failure,
+		Message:              e.Message,
+	}
+	if e.JRD != nil {
+		r := &webfinger.Result{
+			JRD:           e.JRD,
+			QueryURL:      parseURL(e.QueryURL),
+			FinalURL:      parseURL(e.FinalURL),
+			Strategy:      e.Strategy,
+			WebFistServer: e.WebFistServer,
+			StatusCode:    e.StatusCode,
+			Header:        e.Header,
+		}
+		if r.QueryURL != nil {
+			r.Scheme = r.QueryURL.Scheme
+		}
+		for _, s := range e.Redirects {
+			if u := parseURL(s); u != nil {
+				r.Redirects = append(r.Redirects, u)
+			}
+		}
+		ce.Result = r
+	}
+	return ce
+}
+
+func urlString(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	return u.String()
+}
+
+func parseURL(s string) *url.URL {
+	if s == "" {
+		return nil
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil
+	}
+	return u
+}
@@ -0,0 +1,229 @@
+package diskcache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-webfinger"
+	"github.com/ant0ine/go-webfinger/jrd"
+)
+
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diskcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := New(filepath.Join(dir, "cache"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := c.Get("acct:bob@example.com "); ok {
+		t.Error("Get returned an entry from an empty cache")
+	}
+
+	now := time.Now().UTC().Round(0)
+	queryURL, _ := url.Parse("https://example.com/.well-known/webfinger?resource=acct%3Abob%40example.com")
+	want := &webfinger.CacheEntry{
+		Result: &webfinger.Result{
+			JRD: &jrd.JRD{
+				Subject: "acct:bob@example.com",
+				Links:   []jrd.Link{{Rel: jrd.RelProfilePage, Href: "https://example.com/@bob"}},
+			},
+			QueryURL:   queryURL,
+			FinalURL:   queryURL,
+			Scheme:     "https",
+			Strategy:   webfinger.StrategyWebFinger,
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Cache-Control": {"max-age=60"}},
+		},
+		Stored:       now,
+		Expires:      now.Add(time.Minute),
+		StaleIfError: time.Hour,
+	}
+	c.Set("acct:bob@example.com ", want)
+	c.Set("acct:alice@example.com ", &webfinger.CacheEntry{
+		Failure: webfinger.FailureNotFound,
+		Message: "404 Not Found",
+		Stored:  now,
+		Expires: now.Add(time.Minute),
+	})
+
+	// a new Cache on the same directory, as after a restart
+	c, _ = New(filepath.Join(dir, "cache"), 0)
+	got, ok := c.Get("acct:bob@example.com ")
+	if !ok {
+		t.Fatal("Get returned no entry")
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Get returned %+v, want %+v", got.Result, want.Result)
+	}
+	got, ok = c.Get("acct:alice@example.com ")
+	if !ok || got.Result != nil || got.Failure != webfinger.FailureNotFound {
+		t.Errorf("Get returned %+v, want a negative entry", got)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "cache", "*"))
+	if len(files) != 2 {
+		t.Errorf("Cache directory holds %v, want 2 files", files)
+	}
+}
+
+func TestCache_eviction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diskcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	entry := &webfinger.CacheEntry{Failure: webfinger.FailureNotFound, Message: strings.Repeat("x", 100)}
+	content, _ := json.Marshal(newEntry("acct:0@example.com", entry))
+	c, _ := New(dir, int64(3*len(content)))
+
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprintf("acct:%d@example.com", i)
+		c.Set(key, entry)
+		// make the write order visible to the eviction
+		mtime := time.Now().Add(time.Duration(i-10) * time.Second)
+		os.Chtimes(c.path(key), mtime, mtime)
+	}
+
+	for i := 0; i < 5; i++ {
+		_, ok := c.Get(fmt.Sprintf("acct:%d@example.com", i))
+		if want := i >= 2; ok != want {
+			t.Errorf("Entry %d cached: %v, want %v", i, ok, want)
+		}
+	}
+}
+
+func TestCache_sweep(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diskcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, _ := New(dir, 0)
+	now := time.Now()
+	c.Set("expired", &webfinger.CacheEntry{Failure: webfinger.FailureNotFound, Expires: now.Add(-time.Minute)})
+	c.Set("stale", &webfinger.CacheEntry{
+		Result:       &webfinger.Result{JRD: &jrd.JRD{Subject: "acct:bob@example.com"}},
+		Expires:      now.Add(-time.Minute),
+		StaleIfError: time.Hour,
+	})
+	c.Set("fresh", &webfinger.CacheEntry{Failure: webfinger.FailureNotFound, Expires: now.Add(time.Minute)})
+
+	leftover := filepath.Join(dir, tmpPrefix+"1")
+	ioutil.WriteFile(leftover, []byte("{"), 0600)
+	old := now.Add(-2 * tmpMaxAge)
+	os.Chtimes(leftover, old, old)
+	writing := filepath.Join(dir, tmpPrefix+"2")
+	ioutil.WriteFile(writing, []byte("{"), 0600)
+
+	if err := c.Sweep(); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]bool{"expired": false, "stale": true, "fresh": true} {
+		if _, ok := c.Get(key); ok != want {
+			t.Errorf("Entry %s cached: %v, want %v", key, ok, want)
+		}
+	}
+	if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+		t.Errorf("Leftover temporary file not removed: %v", err)
+	}
+	if _, err := os.Stat(writing); err != nil {
+		t.Errorf("Recent temporary file removed: %v", err)
+	}
+	if got, want := len(c.files), 2; got != want {
+		t.Errorf("Cache tracks %d files, want %d", got, want)
+	}
+}
+
+func TestCache_headers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diskcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, _ := New(dir, 0)
+	c.Set("acct:bob@example.com ", &webfinger.CacheEntry{
+		Result: &webfinger.Result{
+			JRD: &jrd.JRD{Subject: "acct:bob@example.com"},
+			Header: http.Header{
+				"Cache-Control": {"max-age=60"},
+				"Etag":          {`"1"`},
+				"Set-Cookie":    {"session=secret"},
+			},
+		},
+		Expires: time.Now().Add(time.Minute),
+	})
+
+	got, ok := c.Get("acct:bob@example.com ")
+	if !ok {
+		t.Fatal("Get returned no entry")
+	}
+	want := http.Header{"Cache-Control": {"max-age=60"}, "Etag": {`"1"`}}
+	if !reflect.DeepEqual(got.Result.Header, want) {
+		t.Errorf("Cached header is %v, want %v", got.Result.Header, want)
+	}
+	content, _ := ioutil.ReadFile(c.path("acct:bob@example.com "))
+	if strings.Contains(string(content), "secret") {
+		t.Errorf("Cache file holds the cookie: %s", content)
+	}
+}
+
+func TestCache_client(t *testing.T) {
+	requests := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Add("content-type", "application/jrd+json")
+		w.Header().Add("cache-control", "max-age=60")
+		fmt.Fprint(w, `{"subject":"acct:bob@example.com"}`)
+	}))
+	defer s.Close()
+	u, _ := url.Parse(s.URL)
+
+	dir, err := ioutil.TempDir("", "diskcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for i := 0; i < 2; i++ {
+		cache, err := New(dir, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := webfinger.NewClient(nil)
+		client.SchemePolicy = webfinger.HTTPOnlyForHosts(u.Host)
+		client.Cache = cache
+
+		result, err := client.LookupWithInfo("bob@"+u.Host, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := webfinger.CacheMiss
+		if i > 0 {
+			want = webfinger.CacheHit
+		}
+		if result.CacheStatus != want {
+			t.Errorf("Lookup %d has cache status %q, want %q", i, result.CacheStatus, want)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("Server received %d requests, want 1", requests)
+	}
+}
@@ -0,0 +1,55 @@
+package dkim
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+var (
+	headerCanonicalizers = map[string]func(string) string{
+		"simple":  func(h string) string { return h },
+		"relaxed": relaxedHeader,
+	}
+	bodyCanonicalizers = map[string]func([]byte) []byte{
+		"simple":  simpleBody,
+		"relaxed": relaxedBody,
+	}
+
+	wsp = regexp.MustCompile(`[ \t]+`)
+)
+
+// relaxedHeader implements the "relaxed" header canonicalization algorithm,
+// RFC 6376 section 3.4.2.
+func relaxedHeader(h string) string {
+	colon := strings.Index(h, ":")
+	name := strings.ToLower(strings.TrimRight(h[:colon], " \t"))
+	value := strings.NewReplacer("\r\n", "", "\n", "").Replace(h[colon+1:])
+	value = strings.TrimSpace(wsp.ReplaceAllString(value, " "))
+	return name + ":" + value + "\r\n"
+}
+
+// simpleBody implements the "simple" body canonicalization algorithm, RFC
+// 6376 section 3.4.3.
+func simpleBody(body []byte) []byte {
+	for bytes.HasSuffix(body, []byte("\r\n")) {
+		body = body[:len(body)-2]
+	}
+	return append(append([]byte{}, body...), '\r', '\n')
+}
+
+// relaxedBody implements the "relaxed" body canonicalization algorithm, RFC
+// 6376 section 3.4.4.
+func relaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(wsp.ReplaceAllString(line, " "), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
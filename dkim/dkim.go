@@ -0,0 +1,376 @@
+// Package dkim provides a minimal DKIM signature verifier, used to check the
+// email proofs of WebFist delegations.
+//
+// Following this spec: http://tools.ietf.org/html/rfc6376
+package dkim
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoSignature is returned by Verify when the message has no DKIM-Signature
+// header.
+var ErrNoSignature = errors.New("dkim: no signature")
+
+// minRSAKeyBits is the minimum size of the RSA keys accepted by Verify.
+const minRSAKeyBits = 1024
+
+// A TXTResolver looks up DNS TXT records.  *net.Resolver is a TXTResolver.
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// Signature is a verified DKIM signature.
+type Signature struct {
+	// Domain is the signing domain (d= tag).
+	Domain string
+
+	// Selector is the key selector (s= tag).
+	Selector string
+
+	// Identity is the agent or user identifier (i= tag), "@" + Domain if not
+	// specified by the signer.
+	Identity string
+
+	// Headers are the names of the signed header fields (h= tag).
+	Headers []string
+
+	// From is the unfolded value of the From header field covered by the
+	// signature.  Header fields are signed from the bottom up, so when a
+	// message has several From fields, it is the last one.
+	From string
+
+	// BodyLength is the length of the canonicalized body covered by the
+	// signature (l= tag), or -1 if the signature covers the whole body.
+	// Content may be appended to messages signed with a length.
+	BodyLength int
+
+	// occurrences counts the header fields of the message by lower case
+	// name.
+	occurrences map[string]int
+}
+
+// Signs reports whether the header field name is covered by sig.
+func (sig *Signature) Signs(name string) bool {
+	return sig.count(name) > 0
+}
+
+// Oversigns reports whether the header field name is listed in the h= tag
+// more times than it occurs in the message, so that adding an instance of the
+// field to the message invalidates the signature (RFC 6376 section 8.15).
+func (sig *Signature) Oversigns(name string) bool {
+	return sig.count(name) > sig.occurrences[strings.ToLower(name)]
+}
+
+// count returns the number of times the header field name is listed in the
+// h= tag.
+func (sig *Signature) count(name string) int {
+	n := 0
+	for _, h := range sig.Headers {
+		if strings.EqualFold(h, name) {
+			n++
+		}
+	}
+	return n
+}
+
+// Verify verifies the DKIM signatures of the raw message, fetching the public
+// keys with resolver.  The valid signatures are returned; an error is returned
+// if none is valid.
+func Verify(ctx context.Context, message []byte, resolver TXTResolver) ([]*Signature, error) {
+	headers, body, err := splitMessage(message)
+	if err != nil {
+		return nil, err
+	}
+
+	var sigs []*Signature
+	err = ErrNoSignature
+	for i, h := range headers {
+		if !strings.EqualFold(h.name, "DKIM-Signature") {
+			continue
+		}
+		var sig *Signature
+		sig, err = verifySignature(ctx, headers[:i], headers[i+1:], h, body, resolver)
+		if err == nil {
+			sigs = append(sigs, sig)
+		}
+	}
+	if len(sigs) == 0 {
+		return nil, err
+	}
+	return sigs, nil
+}
+
+// header is a raw header field, including its folding and trailing CRLF.
+type header struct {
+	name string
+	raw  string
+}
+
+// value returns the unfolded value of h.
+func (h header) value() string {
+	v := h.raw[strings.Index(h.raw, ":")+1:]
+	return strings.NewReplacer("\r\n", "", "\n", "").Replace(v)
+}
+
+func splitMessage(message []byte) ([]header, []byte, error) {
+	// emails stored on disk often use bare LF line endings
+	if !bytes.Contains(message, []byte("\r\n")) {
+		message = bytes.Replace(message, []byte("\n"), []byte("\r\n"), -1)
+	}
+
+	end := bytes.Index(message, []byte("\r\n\r\n"))
+	if end < 0 {
+		return nil, nil, errors.New("dkim: malformed message, no header/body separator")
+	}
+	head, body := string(message[:end+2]), message[end+4:]
+
+	var headers []header
+	for _, line := range strings.SplitAfter(head, "\r\n") {
+		if line == "" {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if len(headers) == 0 {
+				return nil, nil, errors.New("dkim: malformed message, continuation without header")
+			}
+			headers[len(headers)-1].raw += line
+			continue
+		}
+		colon := strings.Index(line, ":")
+		if colon <= 0 {
+			return nil, nil, fmt.Errorf("dkim: malformed header: %q", line)
+		}
+		headers = append(headers, header{name: strings.TrimSpace(line[:colon]), raw: line})
+	}
+	return headers, body, nil
+}
+
+func parseTags(s string) (map[string]string, error) {
+	tags := map[string]string{}
+	for _, part := range strings.Split(s, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		eq := strings.Index(part, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("dkim: malformed tag: %q", part)
+		}
+		name := strings.TrimSpace(part[:eq])
+		if _, dup := tags[name]; dup {
+			return nil, fmt.Errorf("dkim: duplicate tag: %s", name)
+		}
+		tags[name] = strings.TrimSpace(part[eq+1:])
+	}
+	return tags, nil
+}
+
+// stripSpace removes all whitespace from s, as found in folded base64 values.
+func stripSpace(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
+
+// hashHeaders writes the header fields named in names to h, canonicalized with
+// canon.  Header fields are picked from the bottom up, so a name occurring
+// twice in names signs the last two instances of the field.
+func hashHeaders(h hash.Hash, headers []header, names []string, canon func(string) string) {
+	used := make([]bool, len(headers))
+	for _, name := range names {
+		for i := len(headers) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(headers[i].name, name) {
+				used[i] = true
+				h.Write([]byte(canon(headers[i].raw)))
+				break
+			}
+		}
+	}
+}
+
+var bTag = regexp.MustCompile(`(^|;)(\s*b\s*=)[^;]*`)
+
+func verifySignature(ctx context.Context, before, after []header, sigHeader header, body []byte, resolver TXTResolver) (*Signature, error) {
+	tags, err := parseTags(sigHeader.value())
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"v", "a", "b", "bh", "d", "h", "s"} {
+		if tags[name] == "" {
+			return nil, fmt.Errorf("dkim: missing %s= tag", name)
+		}
+	}
+	if tags["v"] != "1" {
+		return nil, fmt.Errorf("dkim: unsupported version: %s", tags["v"])
+	}
+	if x := tags["x"]; x != "" {
+		expires, err := strconv.ParseInt(x, 10, 64)
+		if err != nil || time.Now().Unix() > expires {
+			return nil, errors.New("dkim: signature expired")
+		}
+	}
+
+	sig := &Signature{
+		Domain:      strings.ToLower(tags["d"]),
+		Selector:    tags["s"],
+		Identity:    tags["i"],
+		BodyLength:  -1,
+		occurrences: map[string]int{},
+	}
+	if sig.Identity == "" {
+		sig.Identity = "@" + sig.Domain
+	}
+	if !strings.HasSuffix(strings.ToLower(sig.Identity), "@"+sig.Domain) &&
+		!strings.HasSuffix(strings.ToLower(sig.Identity), "."+sig.Domain) {
+		return nil, errors.New("dkim: identity not in signing domain")
+	}
+	for _, h := range strings.Split(tags["h"], ":") {
+		sig.Headers = append(sig.Headers, strings.TrimSpace(h))
+	}
+	if !sig.Signs("From") {
+		return nil, errors.New("dkim: From header not signed")
+	}
+	headers := append(append([]header{}, before...), after...)
+	for _, h := range headers {
+		name := strings.ToLower(h.name)
+		sig.occurrences[name]++
+		if name == "from" {
+			sig.From = strings.TrimSpace(h.value())
+		}
+	}
+
+	headerCanon, bodyCanon := "simple", "simple"
+	if c := tags["c"]; c != "" {
+		parts := strings.SplitN(c, "/", 2)
+		headerCanon = parts[0]
+		if len(parts) == 2 {
+			bodyCanon = parts[1]
+		}
+	}
+	canonHeader, ok := headerCanonicalizers[headerCanon]
+	if !ok {
+		return nil, fmt.Errorf("dkim: unsupported header canonicalization: %s", headerCanon)
+	}
+	canonBody, ok := bodyCanonicalizers[bodyCanon]
+	if !ok {
+		return nil, fmt.Errorf("dkim: unsupported body canonicalization: %s", bodyCanon)
+	}
+
+	// body hash
+	cbody := canonBody(body)
+	if l := tags["l"]; l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 0 || n > len(cbody) {
+			return nil, errors.New("dkim: invalid body length")
+		}
+		cbody = cbody[:n]
+		sig.BodyLength = n
+	}
+	bh := sha256.Sum256(cbody)
+	if base64.StdEncoding.EncodeToString(bh[:]) != stripSpace(tags["bh"]) {
+		return nil, errors.New("dkim: body hash mismatch")
+	}
+
+	// header hash
+	h := sha256.New()
+	hashHeaders(h, headers, sig.Headers, canonHeader)
+	unsigned := sigHeader.raw[:strings.Index(sigHeader.raw, ":")+1] +
+		bTag.ReplaceAllString(sigHeader.raw[strings.Index(sigHeader.raw, ":")+1:], "$1$2")
+	h.Write([]byte(strings.TrimSuffix(canonHeader(unsigned), "\r\n")))
+	hashed := h.Sum(nil)
+
+	value, err := base64.StdEncoding.DecodeString(stripSpace(tags["b"]))
+	if err != nil {
+		return nil, fmt.Errorf("dkim: invalid signature: %v", err)
+	}
+
+	key, err := lookupKey(ctx, resolver, sig.Selector, sig.Domain)
+	if err != nil {
+		return nil, err
+	}
+
+	switch tags["a"] {
+	case "rsa-sha256":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("dkim: key is not an RSA key")
+		}
+		if err := rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, hashed, value); err != nil {
+			return nil, fmt.Errorf("dkim: %v", err)
+		}
+	case "ed25519-sha256":
+		edKey, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, errors.New("dkim: key is not an Ed25519 key")
+		}
+		if !ed25519.Verify(edKey, hashed, value) {
+			return nil, errors.New("dkim: verification error")
+		}
+	default:
+		return nil, fmt.Errorf("dkim: unsupported algorithm: %s", tags["a"])
+	}
+
+	return sig, nil
+}
+
+// lookupKey fetches the public key of selector for domain.
+func lookupKey(ctx context.Context, resolver TXTResolver, selector, domain string) (crypto.PublicKey, error) {
+	records, err := resolver.LookupTXT(ctx, selector+"._domainkey."+domain)
+	if err != nil {
+		return nil, fmt.Errorf("dkim: key lookup failed: %v", err)
+	}
+	if len(records) == 0 {
+		return nil, errors.New("dkim: no key record")
+	}
+
+	tags, err := parseTags(strings.Join(records, ""))
+	if err != nil {
+		return nil, err
+	}
+	if v := tags["v"]; v != "" && v != "DKIM1" {
+		return nil, fmt.Errorf("dkim: unsupported key version: %s", v)
+	}
+	p := stripSpace(tags["p"])
+	if p == "" {
+		return nil, errors.New("dkim: key revoked")
+	}
+	der, err := base64.StdEncoding.DecodeString(p)
+	if err != nil {
+		return nil, fmt.Errorf("dkim: invalid key: %v", err)
+	}
+
+	switch tags["k"] {
+	case "", "rsa":
+		var key crypto.PublicKey
+		key, err = x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			if key, err = x509.ParsePKCS1PublicKey(der); err != nil {
+				return nil, err
+			}
+		}
+		// RFC 8301 section 3.2: verifiers must not accept shorter keys
+		if rsaKey, ok := key.(*rsa.PublicKey); ok && rsaKey.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("dkim: RSA key too short: %d bits", rsaKey.N.BitLen())
+		}
+		return key, nil
+	case "ed25519":
+		if len(der) != ed25519.PublicKeySize {
+			return nil, errors.New("dkim: invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(der), nil
+	}
+	return nil, fmt.Errorf("dkim: unsupported key type: %s", tags["k"])
+}
@@ -0,0 +1,298 @@
+package dkim
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// fakeResolver serves TXT records from a map.
+type fakeResolver map[string]string
+
+func (r fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if txt, ok := r[name]; ok {
+		return []string{txt}, nil
+	}
+	return nil, errors.New("no such host")
+}
+
+const message = "From: Bob <bob@example.com>\r\n" +
+	"To: delegate@webfist.org\r\n" +
+	"Subject: WebFist delegation\r\n" +
+	"Date: Tue, 4 Mar 2014 10:00:00 -0800\r\n" +
+	"\r\n" +
+	"webfist = https://example.net/bob.json\r\n"
+
+func TestSignVerify(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	for _, key := range []crypto.Signer{rsaKey, edKey} {
+		txt, err := TXTRecord(key.Public())
+		if err != nil {
+			t.Fatal(err)
+		}
+		resolver := fakeResolver{"sel._domainkey.example.com": txt}
+
+		signed, err := Sign([]byte(message), "example.com", "sel", key, nil)
+		if err != nil {
+			t.Fatalf("Sign returned error for %T: %v", key, err)
+		}
+
+		sigs, err := Verify(context.Background(), signed, resolver)
+		if err != nil {
+			t.Fatalf("Verify returned error for %T: %v", key, err)
+		}
+		if got, want := sigs[0].Domain, "example.com"; got != want {
+			t.Errorf("Signature domain is %q, want %q", got, want)
+		}
+		if !sigs[0].Signs("from") {
+			t.Error("Signature does not sign the From header")
+		}
+
+		// bare LF line endings, as stored on disk
+		lf := strings.Replace(string(signed), "\r\n", "\n", -1)
+		if _, err := Verify(context.Background(), []byte(lf), resolver); err != nil {
+			t.Errorf("Verify returned error for LF message: %v", err)
+		}
+
+		// relaxed canonicalization tolerates whitespace changes
+		relaxed := strings.Replace(string(signed), "Subject: WebFist", "Subject:  WebFist", 1)
+		if _, err := Verify(context.Background(), []byte(relaxed), resolver); err != nil {
+			t.Errorf("Verify returned error for re-spaced message: %v", err)
+		}
+
+		tampered := strings.Replace(string(signed), "example.net", "example.org", 1)
+		if _, err := Verify(context.Background(), []byte(tampered), resolver); err == nil {
+			t.Error("Verify returned no error for tampered body")
+		}
+
+		tampered = strings.Replace(string(signed), "From: Bob", "From: Mallory", 1)
+		if _, err := Verify(context.Background(), []byte(tampered), resolver); err == nil {
+			t.Error("Verify returned no error for tampered header")
+		}
+
+		if _, err := Verify(context.Background(), signed, fakeResolver{}); err == nil {
+			t.Error("Verify returned no error without key")
+		}
+	}
+}
+
+func TestVerify_noSignature(t *testing.T) {
+	_, err := Verify(context.Background(), []byte(message), fakeResolver{})
+	if err != ErrNoSignature {
+		t.Errorf("Verify returned %v, want %v", err, ErrNoSignature)
+	}
+}
+
+func TestVerify_fromNotSigned(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 1024)
+	txt, _ := TXTRecord(&key.PublicKey)
+	signed, err := Sign([]byte(message), "example.com", "sel", key, []string{"Subject"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Verify(context.Background(), signed, fakeResolver{"sel._domainkey.example.com": txt})
+	if err == nil {
+		t.Error("Verify returned no error for a signature not covering From")
+	}
+}
+
+// Example from RFC 6376 section 3.4.5.
+func TestCanonicalization(t *testing.T) {
+	headers, body, err := splitMessage([]byte("A: X\r\nB : Y\t\r\n\tZ  \r\n\r\n C \r\nD \t E\r\n\r\n\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got string
+	for _, h := range headers {
+		got += relaxedHeader(h.raw)
+	}
+	if want := "a:X\r\nb:Y Z\r\n"; got != want {
+		t.Errorf("relaxed headers are %q, want %q", got, want)
+	}
+	if got, want := string(relaxedBody(body)), " C\r\nD E\r\n"; got != want {
+		t.Errorf("relaxed body is %q, want %q", got, want)
+	}
+	if got, want := string(simpleBody(body)), " C \r\nD \t E\r\n"; got != want {
+		t.Errorf("simple body is %q, want %q", got, want)
+	}
+	if got, want := string(simpleBody(nil)), "\r\n"; got != want {
+		t.Errorf("simple empty body is %q, want %q", got, want)
+	}
+	if got := relaxedBody(nil); len(got) != 0 {
+		t.Errorf("relaxed empty body is %q, want empty", got)
+	}
+}
+
+func TestVerify_headers(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 1024)
+	txt, _ := TXTRecord(&key.PublicKey)
+	resolver := fakeResolver{"sel._domainkey.example.com": txt}
+
+	signed, _ := Sign([]byte(message), "example.com", "sel", key, nil)
+	sigs, err := Verify(context.Background(), signed, resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sigs[0].From, "Bob <bob@example.com>"; got != want {
+		t.Errorf("Signed From is %q, want %q", got, want)
+	}
+	if !sigs[0].Oversigns("From") || sigs[0].Oversigns("To") {
+		t.Errorf("Signature with headers %v oversigns From: %v, To: %v, want true, false",
+			sigs[0].Headers, sigs[0].Oversigns("From"), sigs[0].Oversigns("To"))
+	}
+	if got := sigs[0].BodyLength; got != -1 {
+		t.Errorf("BodyLength is %d, want -1", got)
+	}
+
+	// an unsigned From header added on top: the bottom one is signed
+	added := append([]byte("From: mallory@example.com\r\n"), signed...)
+	sigs, err = Verify(context.Background(), added, resolver)
+	if err == nil {
+		t.Errorf("Verify returned no error for an added From header on an oversigned message: %+v", sigs[0])
+	}
+
+	signed, _ = Sign([]byte(message), "example.com", "sel", key, []string{"From", "To"})
+	sigs, err = Verify(context.Background(), append([]byte("From: mallory@example.com\r\n"), signed...), resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sigs[0].From, "Bob <bob@example.com>"; got != want {
+		t.Errorf("Signed From is %q, want %q", got, want)
+	}
+	if sigs[0].Oversigns("From") {
+		t.Error("Signature oversigns From with a single From in h=")
+	}
+}
+
+func TestVerify_bodyLength(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 1024)
+	txt, _ := TXTRecord(&key.PublicKey)
+	resolver := fakeResolver{"sel._domainkey.example.com": txt}
+
+	_, body, _ := splitMessage([]byte(message))
+	n := len(relaxedBody(body))
+	signed, err := sign([]byte(message), "example.com", "sel", key, nil, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// content appended after the signed length does not invalidate the
+	// signature, but is reported through BodyLength
+	appended := append(append([]byte{}, signed...), "webfist = https://evil.example/jrd\r\n"...)
+	sigs, err := Verify(context.Background(), appended, resolver)
+	if err != nil {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if got := sigs[0].BodyLength; got != n {
+		t.Errorf("BodyLength is %d, want %d", got, n)
+	}
+}
+
+// Example from RFC 8463 appendix A, signed with both an Ed25519 and an RSA key.
+const rfc8463Message = "DKIM-Signature: v=1; a=ed25519-sha256; c=relaxed/relaxed;\r\n" +
+	" d=football.example.com; i=@football.example.com;\r\n" +
+	" q=dns/txt; s=brisbane; t=1528637909; h=from : to :\r\n" +
+	" subject : date : message-id : from : subject : date;\r\n" +
+	" bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;\r\n" +
+	" b=/gCrinpcQOoIfuHNQIbq4pgh9kyIK3AQUdt9OdqQehSwhEIug4D11Bus\r\n" +
+	" Fa3bT3FY5OsU7ZbnKELq+eXdp1Q1Dw==\r\n" +
+	"DKIM-Signature: v=1; a=rsa-sha256; c=relaxed/relaxed;\r\n" +
+	" d=football.example.com; i=@football.example.com;\r\n" +
+	" q=dns/txt; s=test; t=1528637909; h=from : to : subject :\r\n" +
+	" date : message-id : from : subject : date;\r\n" +
+	" bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;\r\n" +
+	" b=F45dVWDfMbQDGHJFlXUNB2HKfbCeLRyhDXgFpEL8GwpsRe0IeIixNTe3\r\n" +
+	" DhCVlUrSjV4BwcVcOF6+FF3Zo9Rpo1tFOeS9mPYQTnGdaSGsgeefOsk2Jz\r\n" +
+	" dA+L10TeYt9BgDfQNZtKdN1WO//KgIqXP7OdEFE4LjFYNcUxZQ4FADY+8=\r\n" +
+	"From: Joe SixPack <joe@football.example.com>\r\n" +
+	"To: Suzie Q <suzie@shopping.example.net>\r\n" +
+	"Subject: Is dinner ready?\r\n" +
+	"Date: Fri, 11 Jul 2003 21:00:37 -0700 (PDT)\r\n" +
+	"Message-ID: <20030712040037.46341.5F8J@football.example.com>\r\n" +
+	"\r\n" +
+	"Hi.\r\n" +
+	"\r\n" +
+	"We lost the game.  Are you hungry yet?\r\n" +
+	"\r\n" +
+	"Joe.\r\n"
+
+var rfc8463Resolver = fakeResolver{
+	"brisbane._domainkey.football.example.com": "v=DKIM1; k=ed25519; p=11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo=",
+	"test._domainkey.football.example.com": "v=DKIM1; k=rsa; " +
+		"p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQDkHlOQoBTzWRiGs5V6NpP3idY6Wk08a5qhdR6wy5bdOKb2jLQiY/J16JYi0Qvx/byYzCNb3W91y3FutACDfzwQ/BC/e/8uBsCR+yz1Lxj+PL6lHvqMKrM3rG4hstT5QjvHO9PzoxZyVYLzBfO2EeC3Ip3G+2kryOTIKT+l/K4w3QIDAQAB",
+}
+
+func TestVerify_rfc8463(t *testing.T) {
+	sigs, err := Verify(context.Background(), []byte(rfc8463Message), rfc8463Resolver)
+	if err != nil {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if len(sigs) != 2 {
+		t.Fatalf("Verify returned %d signatures, want 2", len(sigs))
+	}
+	for i, selector := range []string{"brisbane", "test"} {
+		if sigs[i].Selector != selector || sigs[i].Domain != "football.example.com" {
+			t.Errorf("Signature %d is %s._domainkey.%s, want %s._domainkey.football.example.com",
+				i, sigs[i].Selector, sigs[i].Domain, selector)
+		}
+	}
+}
+
+func TestVerify_simple(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	txt, _ := TXTRecord(key.Public())
+	resolver := fakeResolver{"sel._domainkey.example.com": txt}
+
+	// Sign only produces relaxed/relaxed signatures
+	headers, body, _ := splitMessage([]byte(message))
+	bh := sha256.Sum256(simpleBody(body))
+	sigHeader := "DKIM-Signature: v=1; a=ed25519-sha256; c=simple/simple; d=example.com; s=sel;\r\n" +
+		" h=From:To:Subject; bh=" + base64.StdEncoding.EncodeToString(bh[:]) + "; b="
+	h := sha256.New()
+	hashHeaders(h, headers, []string{"From", "To", "Subject"}, headerCanonicalizers["simple"])
+	h.Write([]byte(sigHeader))
+	signed := sigHeader + base64.StdEncoding.EncodeToString(ed25519.Sign(key, h.Sum(nil))) + "\r\n" + message
+
+	if _, err := Verify(context.Background(), []byte(signed), resolver); err != nil {
+		t.Errorf("Verify returned error: %v", err)
+	}
+
+	// simple canonicalization does not tolerate whitespace changes
+	respaced := strings.Replace(signed, "Subject: WebFist", "Subject:  WebFist", 1)
+	if _, err := Verify(context.Background(), []byte(respaced), resolver); err == nil {
+		t.Error("Verify returned no error for a re-spaced header")
+	}
+	respaced = strings.Replace(signed, "webfist = ", "webfist =  ", 1)
+	if _, err := Verify(context.Background(), []byte(respaced), resolver); err == nil {
+		t.Error("Verify returned no error for a re-spaced body")
+	}
+
+	// trailing empty lines are ignored
+	if _, err := Verify(context.Background(), []byte(signed+"\r\n\r\n"), resolver); err != nil {
+		t.Errorf("Verify returned error with trailing empty lines: %v", err)
+	}
+}
+
+func TestLookupKey_shortRSA(t *testing.T) {
+	// a 512 bit modulus; only the size matters
+	n := new(big.Int).Lsh(big.NewInt(1), 511)
+	txt, err := TXTRecord(&rsa.PublicKey{N: n.Add(n, big.NewInt(1)), E: 65537})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = lookupKey(context.Background(), fakeResolver{"sel._domainkey.example.com": txt}, "sel", "example.com")
+	if err == nil {
+		t.Error("lookupKey returned no error for a 512 bit RSA key")
+	}
+}
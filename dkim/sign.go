@@ -0,0 +1,90 @@
+package dkim
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// Sign signs the raw message for domain with key, using relaxed/relaxed
+// canonicalization, and returns the message with its DKIM-Signature header
+// prepended.  The public key must be published at
+// <selector>._domainkey.<domain>.  If headers is nil, the From, To, Subject
+// and Date header fields are signed, and From is oversigned so that no From
+// field can be added to the signed message.
+func Sign(message []byte, domain, selector string, key crypto.Signer, headers []string) ([]byte, error) {
+	return sign(message, domain, selector, key, headers, -1)
+}
+
+// sign implements Sign, signing only the first length bytes of the
+// canonicalized body if length is not negative.
+func sign(message []byte, domain, selector string, key crypto.Signer, headers []string, length int) ([]byte, error) {
+	hs, body, err := splitMessage(message)
+	if err != nil {
+		return nil, err
+	}
+	if headers == nil {
+		headers = []string{"From", "From", "To", "Subject", "Date"}
+	}
+
+	var alg string
+	switch key.Public().(type) {
+	case *rsa.PublicKey:
+		alg = "rsa-sha256"
+	case ed25519.PublicKey:
+		alg = "ed25519-sha256"
+	default:
+		return nil, fmt.Errorf("dkim: unsupported key type %T", key.Public())
+	}
+
+	cbody, lTag := relaxedBody(body), ""
+	if length >= 0 {
+		cbody, lTag = cbody[:length], fmt.Sprintf(" l=%d;", length)
+	}
+	bh := sha256.Sum256(cbody)
+	sigHeader := fmt.Sprintf("DKIM-Signature: v=1; a=%s; c=relaxed/relaxed; d=%s; s=%s; h=%s;%s bh=%s; b=",
+		alg, domain, selector, strings.Join(headers, ":"), lTag, base64.StdEncoding.EncodeToString(bh[:]))
+
+	h := sha256.New()
+	hashHeaders(h, hs, headers, relaxedHeader)
+	h.Write([]byte(strings.TrimSuffix(relaxedHeader(sigHeader), "\r\n")))
+	hashed := h.Sum(nil)
+
+	var value []byte
+	if alg == "ed25519-sha256" {
+		value, err = key.Sign(rand.Reader, hashed, crypto.Hash(0))
+	} else {
+		value, err = key.Sign(rand.Reader, hashed, crypto.SHA256)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signed := sigHeader + base64.StdEncoding.EncodeToString(value) + "\r\n"
+	for _, h := range hs {
+		signed += h.raw
+	}
+	return append([]byte(signed+"\r\n"), body...), nil
+}
+
+// TXTRecord returns the DNS TXT record publishing the public key of key, to
+// be served at <selector>._domainkey.<domain>.
+func TXTRecord(key crypto.PublicKey) (string, error) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		der, err := x509.MarshalPKIXPublicKey(k)
+		if err != nil {
+			return "", err
+		}
+		return "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(der), nil
+	case ed25519.PublicKey:
+		return "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(k), nil
+	}
+	return "", fmt.Errorf("dkim: unsupported key type %T", key)
+}
@@ -0,0 +1,292 @@
+package webfinger
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dnsPrefix is prepended to hosts to look up the DNS records of their
+// WebFinger endpoint.
+const dnsPrefix = "_webfinger._tcp."
+
+const (
+	// defaultDNSTTL is the time discovery results are cached for when no
+	// TTL is known.
+	defaultDNSTTL = 5 * time.Minute
+
+	// defaultDNSErrorTTL is the time failed discoveries are cached for.
+	defaultDNSErrorTTL = 30 * time.Second
+
+	// defaultDNSCacheSize is the maximum number of hosts cached.
+	defaultDNSCacheSize = 10000
+)
+
+// A URIRecord is a DNS URI record (RFC 7553).
+type URIRecord struct {
+	Priority uint16
+	Weight   uint16
+	Target   string
+	TTL      time.Duration
+}
+
+// An SRVRecord is a DNS SRV record (RFC 2782).
+type SRVRecord struct {
+	Priority uint16
+	Weight   uint16
+	Target   string
+	Port     uint16
+	TTL      time.Duration
+}
+
+// A DNSResolver looks up the DNS records used to discover WebFinger
+// endpoints.  Lookups of names without records should return no record and a
+// nil error.
+type DNSResolver interface {
+	LookupURI(ctx context.Context, name string) ([]URIRecord, error)
+	LookupSRV(ctx context.Context, name string) ([]SRVRecord, error)
+}
+
+// NetDNSResolver is a DNSResolver using a net.Resolver.  As net.Resolver
+// supports neither URI records nor TTLs, it only looks up SRV records, which
+// are given TTL.
+type NetDNSResolver struct {
+	// Resolver is the resolver used.  If nil, net.DefaultResolver is used.
+	Resolver *net.Resolver
+
+	// TTL is the TTL given to the records.
+	TTL time.Duration
+}
+
+// LookupURI returns no record.
+func (r NetDNSResolver) LookupURI(ctx context.Context, name string) ([]URIRecord, error) {
+	return nil, nil
+}
+
+// LookupSRV returns the SRV records of name.
+func (r NetDNSResolver) LookupSRV(ctx context.Context, name string) ([]SRVRecord, error) {
+	resolver := r.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	_, srvs, err := resolver.LookupSRV(ctx, "", "", name)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]SRVRecord, len(srvs))
+	for i, srv := range srvs {
+		records[i] = SRVRecord{srv.Priority, srv.Weight, srv.Target, srv.Port, r.TTL}
+	}
+	return records, nil
+}
+
+// DNSHostResolver is a HostResolver discovering the WebFinger endpoint of a
+// host from the URI or SRV records of _webfinger._tcp.<host>.  URI records
+// take precedence, and their target is used as the endpoint.  SRV records
+// give the host and port of the endpoint.  Hosts without records use the
+// default endpoint, as do hosts whose records cannot be looked up.
+//
+// Among records, the one with the lowest priority, then the highest weight, is
+// used, so that discovery is deterministic.  Results are cached for the TTL of
+// the record used.
+//
+// Discovery trusts the DNS answers, which are not authenticated unless the
+// Resolver validates DNSSEC: whoever can spoof them can redirect queries to
+// an endpoint of their choice.  URI records must therefore target https URLs,
+// so that the endpoint still has to prove its identity with a certificate,
+// and JRDs are best verified with a KeySource when this matters.
+type DNSHostResolver struct {
+	// Resolver looks up DNS records.  If nil, a NetDNSResolver with a TTL of
+	// 5 minutes is used.
+	Resolver DNSResolver
+
+	// NegativeTTL is the time hosts without records are cached for.  If
+	// zero, they are cached for 5 minutes.
+	NegativeTTL time.Duration
+
+	// ErrorTTL is the time hosts whose records cannot be looked up are
+	// cached for, using the default endpoint.  If zero, they are cached for
+	// 30 seconds.
+	ErrorTTL time.Duration
+
+	// MaxEntries is the maximum number of hosts cached.  When full, expired
+	// entries are removed first, then the ones expiring first.  If zero,
+	// 10000 hosts are cached.
+	MaxEntries int
+
+	// now returns the current time, for tests.
+	now func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]dnsEntry
+}
+
+type dnsEntry struct {
+	endpoint *url.URL
+	expires  time.Time
+}
+
+// NewDNSHostResolver returns a DNSHostResolver using resolver.
+func NewDNSHostResolver(resolver DNSResolver) *DNSHostResolver {
+	return &DNSHostResolver{Resolver: resolver}
+}
+
+// ResolveHost implements HostResolver.
+func (d *DNSHostResolver) ResolveHost(ctx context.Context, host string) (*url.URL, error) {
+	// hosts with an explicit port are not discovered
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return nil, nil
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	now := d.timeNow()
+	d.mu.Lock()
+	entry, ok := d.cache[host]
+	d.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return copyURL(entry.endpoint), nil
+	}
+
+	endpoint, ttl, err := d.discover(ctx, host)
+	if err != nil {
+		log.Printf("Cannot discover WebFinger endpoint of %s: %v", host, err)
+		endpoint, ttl = nil, d.errorTTL()
+	}
+
+	d.mu.Lock()
+	d.store(host, dnsEntry{endpoint, now.Add(ttl)}, now)
+	d.mu.Unlock()
+
+	return copyURL(endpoint), nil
+}
+
+// store caches entry for host, making room for it if the cache is full.  d.mu
+// must be held.
+func (d *DNSHostResolver) store(host string, entry dnsEntry, now time.Time) {
+	if d.cache == nil {
+		d.cache = map[string]dnsEntry{}
+	}
+	max := d.MaxEntries
+	if max <= 0 {
+		max = defaultDNSCacheSize
+	}
+	if _, ok := d.cache[host]; !ok && len(d.cache) >= max {
+		for h, e := range d.cache {
+			if !now.Before(e.expires) {
+				delete(d.cache, h)
+			}
+		}
+		for len(d.cache) >= max {
+			first := ""
+			for h, e := range d.cache {
+				if first == "" || e.expires.Before(d.cache[first].expires) {
+					first = h
+				}
+			}
+			delete(d.cache, first)
+		}
+	}
+	d.cache[host] = entry
+}
+
+// discover looks up the endpoint of host, and returns it with its TTL.  The
+// endpoint is nil if host has no record.
+func (d *DNSHostResolver) discover(ctx context.Context, host string) (*url.URL, time.Duration, error) {
+	resolver := d.Resolver
+	if resolver == nil {
+		resolver = NetDNSResolver{TTL: defaultDNSTTL}
+	}
+	name := dnsPrefix + host
+
+	uris, err := resolver.LookupURI(ctx, name)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(uris) > 0 {
+		sort.SliceStable(uris, func(i, j int) bool {
+			if uris[i].Priority != uris[j].Priority {
+				return uris[i].Priority < uris[j].Priority
+			}
+			return uris[i].Weight > uris[j].Weight
+		})
+		u, err := url.Parse(uris[0].Target)
+		if err != nil {
+			return nil, 0, err
+		}
+		if !u.IsAbs() || u.Host == "" {
+			return nil, 0, errors.New("URI record target is not an absolute URL: " + uris[0].Target)
+		}
+		// the record is not authenticated, the endpoint must be
+		if u.Scheme != "https" {
+			return nil, 0, errors.New("URI record target is not an https URL: " + uris[0].Target)
+		}
+		return u, uris[0].TTL, nil
+	}
+
+	srvs, err := resolver.LookupSRV(ctx, name)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(srvs) > 0 {
+		sort.SliceStable(srvs, func(i, j int) bool {
+			if srvs[i].Priority != srvs[j].Priority {
+				return srvs[i].Priority < srvs[j].Priority
+			}
+			return srvs[i].Weight > srvs[j].Weight
+		})
+		srv := srvs[0]
+		target := strings.TrimSuffix(srv.Target, ".")
+		if target == "" {
+			// "." means that the service is not available, use the default
+			return nil, srv.TTL, nil
+		}
+		if srv.Port != 0 && srv.Port != 443 {
+			target = net.JoinHostPort(target, strconv.Itoa(int(srv.Port)))
+		}
+		return &url.URL{Host: target}, srv.TTL, nil
+	}
+
+	return nil, d.negativeTTL(), nil
+}
+
+func (d *DNSHostResolver) negativeTTL() time.Duration {
+	if d.NegativeTTL > 0 {
+		return d.NegativeTTL
+	}
+	return defaultDNSTTL
+}
+
+func (d *DNSHostResolver) errorTTL() time.Duration {
+	if d.ErrorTTL > 0 {
+		return d.ErrorTTL
+	}
+	return defaultDNSErrorTTL
+}
+
+func (d *DNSHostResolver) timeNow() time.Time {
+	if d.now != nil {
+		return d.now()
+	}
+	return time.Now()
+}
+
+func copyURL(u *url.URL) *url.URL {
+	if u == nil {
+		return nil
+	}
+	c := *u
+	return &c
+}
@@ -0,0 +1,186 @@
+package webfinger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// fakeDNSResolver is a DNSResolver serving fixed records, and counting
+// lookups.
+type fakeDNSResolver struct {
+	uris    map[string][]URIRecord
+	srvs    map[string][]SRVRecord
+	err     error
+	lookups int
+}
+
+func (r *fakeDNSResolver) LookupURI(ctx context.Context, name string) ([]URIRecord, error) {
+	r.lookups++
+	return r.uris[name], r.err
+}
+
+func (r *fakeDNSResolver) LookupSRV(ctx context.Context, name string) ([]SRVRecord, error) {
+	return r.srvs[name], r.err
+}
+
+func TestDNSHostResolver(t *testing.T) {
+	resolver := &fakeDNSResolver{
+		uris: map[string][]URIRecord{
+			"_webfinger._tcp.example.com": {
+				{Priority: 20, Target: "https://backup.example.net/wf", TTL: time.Minute},
+				{Priority: 10, Weight: 1, Target: "https://light.example.net/wf", TTL: time.Minute},
+				{Priority: 10, Weight: 5, Target: "https://wf.example.net/webfinger", TTL: time.Minute},
+			},
+		},
+		srvs: map[string][]SRVRecord{
+			"_webfinger._tcp.example.org": {
+				{Priority: 10, Target: "wf.example.net.", Port: 8443, TTL: time.Hour},
+			},
+			"_webfinger._tcp.example.edu": {
+				{Priority: 10, Target: "wf.example.net.", Port: 443, TTL: time.Hour},
+			},
+			"_webfinger._tcp.example.info": {
+				{Priority: 0, Target: ".", TTL: time.Hour},
+			},
+		},
+	}
+	d := NewDNSHostResolver(resolver)
+
+	tests := []struct {
+		host, want string
+	}{
+		{"example.com", "https://wf.example.net/webfinger"},
+		{"Example.ORG", "//wf.example.net:8443"},
+		{"example.edu", "//wf.example.net"},
+		{"example.info", ""},
+		{"example.net", ""},
+		{"example.com:8080", ""},
+	}
+	for _, tt := range tests {
+		u, err := d.ResolveHost(context.Background(), tt.host)
+		if err != nil {
+			t.Errorf("ResolveHost(%q) returned error: %v", tt.host, err)
+			continue
+		}
+		got := ""
+		if u != nil {
+			got = u.String()
+		}
+		if got != tt.want {
+			t.Errorf("ResolveHost(%q) returned %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestDNSHostResolver_cache(t *testing.T) {
+	resolver := &fakeDNSResolver{
+		srvs: map[string][]SRVRecord{
+			"_webfinger._tcp.example.org": {{Target: "wf.example.net.", Port: 443, TTL: time.Minute}},
+		},
+	}
+	now := time.Unix(0, 0)
+	d := NewDNSHostResolver(resolver)
+	d.NegativeTTL = time.Hour
+	d.now = func() time.Time { return now }
+
+	resolve := func(host string) {
+		if _, err := d.ResolveHost(context.Background(), host); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resolve("example.org")
+	resolve("example.org")
+	resolve("example.net")
+	if got, want := resolver.lookups, 2; got != want {
+		t.Errorf("Looked up %d times, want %d", got, want)
+	}
+
+	// the SRV record expired, not the negative entry
+	now = now.Add(2 * time.Minute)
+	resolve("example.org")
+	resolve("example.net")
+	if got, want := resolver.lookups, 3; got != want {
+		t.Errorf("Looked up %d times after the record TTL, want %d", got, want)
+	}
+
+	// lookup errors fall back to the default endpoint, and are cached for
+	// ErrorTTL
+	resolver.err = errors.New("SERVFAIL")
+	now = now.Add(2 * time.Hour)
+	for i := 0; i < 2; i++ {
+		if u, err := d.ResolveHost(context.Background(), "example.org"); u != nil || err != nil {
+			t.Errorf("ResolveHost returned (%v, %v) on lookup error, want (nil, nil)", u, err)
+		}
+	}
+	if got, want := resolver.lookups, 4; got != want {
+		t.Errorf("Looked up %d times after errors, want %d", got, want)
+	}
+	now = now.Add(time.Minute)
+	resolve("example.org")
+	if got, want := resolver.lookups, 5; got != want {
+		t.Errorf("Looked up %d times after the error TTL, want %d", got, want)
+	}
+}
+
+func TestDNSHostResolver_maxEntries(t *testing.T) {
+	now := time.Unix(0, 0)
+	d := NewDNSHostResolver(&fakeDNSResolver{})
+	d.MaxEntries = 2
+	d.now = func() time.Time { return now }
+
+	for _, host := range []string{"a.example", "b.example", "c.example", "d.example"} {
+		if _, err := d.ResolveHost(context.Background(), host); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Second)
+	}
+	if got, want := len(d.cache), 2; got != want {
+		t.Errorf("Cache holds %d hosts, want %d", got, want)
+	}
+	if _, ok := d.cache["d.example"]; !ok {
+		t.Error("Cache does not hold the last host")
+	}
+}
+
+func TestDNSHostResolver_httpTarget(t *testing.T) {
+	d := NewDNSHostResolver(&fakeDNSResolver{
+		uris: map[string][]URIRecord{
+			"_webfinger._tcp.example.com": {{Target: "http://wf.example.net/webfinger", TTL: time.Minute}},
+		},
+	})
+	// a spoofable record cannot downgrade queries to http
+	u, err := d.ResolveHost(context.Background(), "example.com")
+	if u != nil || err != nil {
+		t.Errorf("ResolveHost returned (%v, %v) for an http target, want (nil, nil)", u, err)
+	}
+}
+
+func TestLookup_dnsDiscovery(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprintf(w, `{"subject":%q}`, r.FormValue("resource"))
+	})
+
+	client.WebFistServer = ""
+	client.HostResolver = NewDNSHostResolver(&fakeDNSResolver{
+		uris: map[string][]URIRecord{
+			"_webfinger._tcp.example.com": {{Target: "https://" + testHost + "/webfinger", TTL: time.Minute}},
+		},
+	})
+
+	j, err := client.Lookup("bob@example.com", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got, want := j.Subject, "acct:bob@example.com"; got != want {
+		t.Errorf("Subject is %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/ant0ine/go-webfinger"
+)
+
+// Exit codes.
+const (
+	exitOK = 0
+
+	// exitError is returned for errors not classified below.
+	exitError = 1
+
+	// exitUsage is returned for invalid flags or arguments, as the flag
+	// package does.
+	exitUsage = 2
+
+	// exitNotFound is returned when the server does not know the resource.
+	exitNotFound = 3
+
+	// exitNetwork is returned when the server cannot be reached.
+	exitNetwork = 4
+
+	// exitInvalid is returned when the server response is not a valid JRD,
+	// or is refused.
+	exitInvalid = 5
+)
+
+// originTracker is a webfinger.Instrumentation keeping the error of the
+// WebFinger query of a lookup, before any WebFist fallback, so that the exit
+// code reflects the resource host rather than the WebFist servers.
+type originTracker struct {
+	webfinger.NopInstrumentation
+
+	mu       sync.Mutex
+	fallback bool
+	err      error
+}
+
+func (t *originTracker) StartFetch(ctx context.Context, u *url.URL) (context.Context, func(webfinger.Attempt)) {
+	return ctx, func(a webfinger.Attempt) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if !t.fallback {
+			t.err = a.Err
+		}
+	}
+}
+
+func (t *originTracker) StartFallback(ctx context.Context, resource *webfinger.Resource, servers []string) (context.Context, func(error)) {
+	t.mu.Lock()
+	t.fallback = true
+	t.mu.Unlock()
+	return ctx, func(error) {}
+}
+
+// originErr returns the error of the WebFinger query if the lookup fell back
+// to WebFist, and err otherwise.
+func (t *originTracker) originErr(err error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.fallback && t.err != nil {
+		return t.err
+	}
+	return err
+}
+
+// exitCode returns the exit code of a lookup failing with err.
+func exitCode(err error) int {
+	var negErr *webfinger.NegativeCacheError
+	if errors.As(err, &negErr) {
+		if negErr.Failure == webfinger.FailureNotFound {
+			return exitNotFound
+		}
+		return exitNetwork
+	}
+
+	var statusErr *webfinger.StatusError
+	if errors.As(err, &statusErr) {
+		if statusErr.StatusCode == http.StatusNotFound || statusErr.StatusCode == http.StatusGone {
+			return exitNotFound
+		}
+		return exitInvalid
+	}
+
+	var redirectErr *webfinger.RedirectError
+	var sigErr *webfinger.SignatureError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &redirectErr) || errors.As(err, &sigErr) || errors.Is(err, webfinger.ErrNoSignature) ||
+		errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+		return exitInvalid
+	}
+
+	var netErr net.Error
+	var urlErr *url.Error
+	if errors.As(err, &netErr) || errors.As(err, &urlErr) {
+		return exitNetwork
+	}
+	return exitError
+}
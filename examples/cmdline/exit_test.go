@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/ant0ine/go-webfinger"
+)
+
+func TestExitCode(t *testing.T) {
+	var v interface{}
+	syntaxErr := json.Unmarshal([]byte("{"), &v)
+
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{&webfinger.StatusError{StatusCode: 404, Status: "404 Not Found"}, exitNotFound},
+		{&webfinger.NegativeCacheError{Failure: webfinger.FailureNotFound}, exitNotFound},
+		{&webfinger.NegativeCacheError{Failure: webfinger.FailureNoHost}, exitNetwork},
+		{&webfinger.StatusError{StatusCode: 500, Status: "500 Internal Server Error"}, exitInvalid},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: &net.DNSError{IsNotFound: true}}, exitNetwork},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: &webfinger.RedirectError{Reason: "downgrade"}}, exitInvalid},
+		{context.DeadlineExceeded, exitNetwork},
+		{fmt.Errorf("lookup: %w", syntaxErr), exitInvalid},
+		{&webfinger.SignatureError{}, exitInvalid},
+		{errors.New("URL must be absolute, or an email address: bob"), exitError},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("exitCode(%v) returned %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestOriginTracker(t *testing.T) {
+	tracker := &originTracker{}
+	notFound := &webfinger.StatusError{StatusCode: 404, Status: "404 Not Found"}
+	webfistErr := errors.New("No WebFist link")
+
+	_, end := tracker.StartFetch(context.Background(), &url.URL{})
+	end(webfinger.Attempt{Err: notFound})
+	if err := tracker.originErr(notFound); err != notFound {
+		t.Errorf("originErr returned %v without fallback, want %v", err, notFound)
+	}
+
+	tracker.StartFallback(context.Background(), nil, []string{"webfist.org"})
+	_, end = tracker.StartFetch(context.Background(), &url.URL{})
+	end(webfinger.Attempt{Err: webfistErr})
+	if err := tracker.originErr(webfistErr); err != notFound {
+		t.Errorf("originErr returned %v after fallback, want %v", err, notFound)
+	}
+}
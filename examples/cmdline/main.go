@@ -1,22 +1,47 @@
 // TODO
-// * improve JRD output
 // * do stuff with the JRD
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"github.com/ant0ine/go-webfinger"
+	"github.com/ant0ine/go-webfinger/conformance"
+	"github.com/ant0ine/go-webfinger/diskcache"
+	"io"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 )
 
-func printHelp() {
-	fmt.Println("webfinger [-vh] <resource uri>")
+// stringList is a flag.Value collecting the values of a repeated flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// printHelp writes the usage to w: stdout when asked for with -h, stderr on
+// usage errors.
+func printHelp(w io.Writer) {
+	fmt.Fprintln(w, "webfinger [-vh] [-o format] [-q selector] [-rel rel]... [-host endpoint] [-cache dir] [-conformance base-url] <resource uri>")
+	flag.CommandLine.SetOutput(w)
 	flag.PrintDefaults()
-	fmt.Println("example: webfinger -v bob@example.com") // same Bob as in the draft
+	fmt.Fprintln(w, "example: webfinger -v bob@example.com") // same Bob as in the draft
+	fmt.Fprintln(w, "example: webfinger -q '.links[].href' bob@example.com")
+	fmt.Fprintln(w, "example: webfinger -rel self -host localhost:8080 -insecure bob@example.com")
+	fmt.Fprintf(w, "exit status: %d if the resource is not found, %d on network errors, %d on invalid responses\n",
+		exitNotFound, exitNetwork, exitInvalid)
 }
 
 func main() {
@@ -24,11 +49,27 @@ func main() {
 	// cmd line flags
 	verbose := flag.Bool("v", false, "print details about the resolution")
 	help := flag.Bool("h", false, "display this message")
+	var rels stringList
+	flag.Var(&rels, "rel", "only return the links with this rel (repeatable)")
+	host := flag.String("host", "", "issue the query at this endpoint, a host[:port] or a URL, instead of the host of the resource")
+	httpsOnly := flag.Bool("https-only", false, "do not retry queries over plain HTTP")
+	webfistServers := flag.String("webfist", "", "comma-separated WebFist servers to fall back to")
+	noWebFist := flag.Bool("no-webfist", false, "do not fall back to WebFist")
+	timeout := flag.Duration("timeout", 30*time.Second, "timeout of each HTTP request, 0 for none")
+	userAgent := flag.String("user-agent", webfinger.DefaultUserAgent, "User-Agent of the HTTP requests")
+	insecure := flag.Bool("insecure", false, "do not verify TLS certificates")
+	cacheDir := flag.String("cache", "", "cache lookups in this directory")
+	cacheTTL := flag.Duration("cache-ttl", time.Hour, "time to cache lookups for, when the server does not tell")
+	cacheSize := flag.Int64("cache-size", 10<<20, "maximum size of the cache, in bytes")
+	conformanceURL := flag.String("conformance", "", "check the RFC 7033 conformance of the WebFinger server at this base URL, querying the resource")
+	format := flag.String("o", "json", "output format: "+strings.Join(formatNames(), ", "))
+	colorMode := flag.String("color", "auto", "colorize the table output: auto, always or never")
+	selector := flag.String("q", "", "print the fields of the JRD selected by this jq-style selector, e.g. .links[0].href")
 	flag.Parse()
 
 	if *help {
-		printHelp()
-		os.Exit(0)
+		printHelp(os.Stdout)
+		os.Exit(exitOK)
 	}
 
 	if !*verbose {
@@ -38,26 +79,102 @@ func main() {
 	email := flag.Arg(0)
 
 	if email == "" {
-		printHelp()
-		os.Exit(1)
+		printHelp(os.Stderr)
+		os.Exit(exitUsage)
 	}
 
 	log.SetFlags(0)
 
-	client := webfinger.NewClient(nil)
-	client.AllowHTTP = true
+	write, ok := formats[*format]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "invalid output format %q, want one of %s\n", *format, strings.Join(formatNames(), ", "))
+		os.Exit(exitUsage)
+	}
+	color, err := useColor(*colorMode)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+
+	if *selector != "" {
+		if _, err := parseSelector(*selector); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitUsage)
+		}
+	}
+
+	resource, err := webfinger.Parse(email)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+
+	httpClient := &http.Client{Timeout: *timeout}
+	if *insecure {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		httpClient.Transport = transport
+	}
+
+	if *conformanceURL != "" {
+		report, err := conformance.Check(context.Background(), *conformanceURL, conformance.Options{
+			Resource: resource.String(),
+			Client:   httpClient,
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitError)
+		}
+		fmt.Print(report)
+		if !report.OK() {
+			os.Exit(exitInvalid)
+		}
+		os.Exit(exitOK)
+	}
+
+	client := webfinger.NewClient(httpClient)
+	client.AllowHTTP = !*httpsOnly
+	client.UserAgent = *userAgent
+	if *host != "" {
+		client.HostResolver = webfinger.StaticHosts{resource.WebFingerHost(): *host}
+	}
+	if *webfistServers != "" {
+		for _, server := range strings.Split(*webfistServers, ",") {
+			if server = strings.TrimSpace(server); server != "" {
+				client.WebFistServers = append(client.WebFistServers, server)
+			}
+		}
+	}
+	client.DisableWebFist = *noWebFist
+
+	tracker := &originTracker{}
+	client.Instrumentation = tracker
 
-	jrd, err := client.Lookup(email, nil)
+	if *cacheDir != "" {
+		cache, err := diskcache.New(*cacheDir, *cacheSize)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitError)
+		}
+		client.Cache = cache
+		client.CacheTTL = *cacheTTL
+	}
+
+	jrd, err := client.LookupResource(resource, rels)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitCode(tracker.originErr(err)))
 	}
 
-	bytes, err := json.MarshalIndent(jrd, "", "  ")
+	if *selector != "" {
+		err = writeSelection(os.Stdout, jrd, *selector)
+	} else {
+		err = write(os.Stdout, jrd, color)
+	}
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitError)
 	}
-	fmt.Printf("%s\n", bytes)
 
-	os.Exit(0)
+	os.Exit(exitOK)
 }
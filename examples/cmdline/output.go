@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ant0ine/go-webfinger/jrd"
+)
+
+// formats are the output formats, by -o value.
+var formats = map[string]func(w io.Writer, j *jrd.JRD, color bool) error{
+	"json":  writeJSON,
+	"yaml":  writeYAML,
+	"table": writeTable,
+	"xrd":   writeXRD,
+	"links": writeLinks,
+}
+
+// formatNames returns the names of the output formats, sorted.
+func formatNames() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// useColor tells whether to colorize the output, from the -color flag: auto
+// colorizes when stdout is a terminal and NO_COLOR is not set.
+func useColor(mode string) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		if os.Getenv("NO_COLOR") != "" {
+			return false, nil
+		}
+		info, err := os.Stdout.Stat()
+		return err == nil && info.Mode()&os.ModeCharDevice != 0, nil
+	}
+	return false, fmt.Errorf("invalid color mode %q, want auto, always or never", mode)
+}
+
+// ANSI styles of the table output.
+const (
+	styleReset  = "\x1b[0m"
+	styleBold   = "\x1b[1m"
+	styleHeader = "\x1b[1;36m"
+	styleRel    = "\x1b[32m"
+	styleHref   = "\x1b[34m"
+	styleDim    = "\x1b[2m"
+)
+
+func paint(color bool, style, s string) string {
+	if !color || s == "" {
+		return s
+	}
+	return style + s + styleReset
+}
+
+func writeJSON(w io.Writer, j *jrd.JRD, color bool) error {
+	bytes, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", bytes)
+	return err
+}
+
+// writeTable writes a human readable summary of j.
+func writeTable(w io.Writer, j *jrd.JRD, color bool) error {
+	header := func(s string) string { return paint(color, styleHeader, fmt.Sprintf("%-11s", s)) }
+
+	fmt.Fprintf(w, "%s %s\n", header("Subject"), paint(color, styleBold, j.Subject))
+	for i, alias := range j.Aliases {
+		label := ""
+		if i == 0 {
+			label = "Aliases"
+		}
+		fmt.Fprintf(w, "%s %s\n", header(label), alias)
+	}
+	for i, name := range sortedKeys(j.Properties) {
+		label := ""
+		if i == 0 {
+			label = "Properties"
+		}
+		fmt.Fprintf(w, "%s %s: %s\n", header(label), name, propertyString(j.Properties[name]))
+	}
+	if len(j.Links) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(w, "%s\n", paint(color, styleHeader, "Links"))
+	width := 0
+	for _, link := range j.Links {
+		if n := len(relName(link.Rel)); n > width {
+			width = n
+		}
+	}
+	indent := strings.Repeat(" ", width+4)
+	for _, link := range j.Links {
+		rel := relName(link.Rel)
+		fmt.Fprintf(w, "  %s%s  %s", paint(color, styleRel, rel), strings.Repeat(" ", width-len(rel)),
+			paint(color, styleHref, link.Href))
+		if link.Type != "" {
+			fmt.Fprintf(w, " %s", paint(color, styleDim, "("+link.Type+")"))
+		}
+		fmt.Fprintln(w)
+		for _, lang := range sortedStringKeys(link.Titles) {
+			fmt.Fprintf(w, "%stitle [%s]: %s\n", indent, lang, link.Titles[lang])
+		}
+		for _, name := range sortedKeys(link.Properties) {
+			fmt.Fprintf(w, "%s%s: %s\n", indent, name, propertyString(link.Properties[name]))
+		}
+	}
+	return nil
+}
+
+// relName returns the short name of rel, if it has one.
+func relName(rel string) string {
+	if name, ok := jrd.RelNames[rel]; ok {
+		return name
+	}
+	return rel
+}
+
+func propertyString(value interface{}) string {
+	if value == nil {
+		return "null"
+	}
+	return fmt.Sprint(value)
+}
+
+// writeLinks writes a line per link, with its rel and href separated by a
+// tab.
+func writeLinks(w io.Writer, j *jrd.JRD, color bool) error {
+	for _, link := range j.Links {
+		if _, err := fmt.Fprintf(w, "%s\t%s\n", link.Rel, link.Href); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeXRD writes j as an XRD document (RFC 6415).
+func writeXRD(w io.Writer, j *jrd.JRD, color bool) error {
+	var b strings.Builder
+	esc := func(s string) string {
+		var e strings.Builder
+		xml.EscapeText(&e, []byte(s))
+		return e.String()
+	}
+	properties := func(indent string, props map[string]interface{}) {
+		for _, name := range sortedKeys(props) {
+			if props[name] == nil {
+				fmt.Fprintf(&b, "%s<Property type=\"%s\" xsi:nil=\"true\"/>\n", indent, esc(name))
+				continue
+			}
+			fmt.Fprintf(&b, "%s<Property type=\"%s\">%s</Property>\n", indent, esc(name), esc(propertyString(props[name])))
+		}
+	}
+
+	b.WriteString(xml.Header)
+	b.WriteString(`<XRD xmlns="http://docs.oasis-open.org/ns/xri/xrd-1.0" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">` + "\n")
+	if j.Subject != "" {
+		fmt.Fprintf(&b, "  <Subject>%s</Subject>\n", esc(j.Subject))
+	}
+	for _, alias := range j.Aliases {
+		fmt.Fprintf(&b, "  <Alias>%s</Alias>\n", esc(alias))
+	}
+	properties("  ", j.Properties)
+	for _, link := range j.Links {
+		b.WriteString("  <Link")
+		for _, attr := range [][2]string{{"rel", link.Rel}, {"type", link.Type}, {"href", link.Href}} {
+			if attr[1] != "" {
+				fmt.Fprintf(&b, " %s=\"%s\"", attr[0], esc(attr[1]))
+			}
+		}
+		if len(link.Titles) == 0 && len(link.Properties) == 0 {
+			b.WriteString("/>\n")
+			continue
+		}
+		b.WriteString(">\n")
+		for _, lang := range sortedStringKeys(link.Titles) {
+			if lang == "und" {
+				fmt.Fprintf(&b, "    <Title>%s</Title>\n", esc(link.Titles[lang]))
+			} else {
+				fmt.Fprintf(&b, "    <Title xml:lang=\"%s\">%s</Title>\n", esc(lang), esc(link.Titles[lang]))
+			}
+		}
+		properties("    ", link.Properties)
+		b.WriteString("  </Link>\n")
+	}
+	b.WriteString("</XRD>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeYAML writes j as a YAML document.
+func writeYAML(w io.Writer, j *jrd.JRD, color bool) error {
+	var b strings.Builder
+	properties := func(indent string, props map[string]interface{}) {
+		for _, name := range sortedKeys(props) {
+			value := "null"
+			if props[name] != nil {
+				value = yamlString(propertyString(props[name]))
+			}
+			fmt.Fprintf(&b, "%s%s: %s\n", indent, yamlString(name), value)
+		}
+	}
+
+	if j.Subject != "" {
+		fmt.Fprintf(&b, "subject: %s\n", yamlString(j.Subject))
+	}
+	if len(j.Aliases) > 0 {
+		b.WriteString("aliases:\n")
+		for _, alias := range j.Aliases {
+			fmt.Fprintf(&b, "  - %s\n", yamlString(alias))
+		}
+	}
+	if len(j.Properties) > 0 {
+		b.WriteString("properties:\n")
+		properties("  ", j.Properties)
+	}
+	if len(j.Links) > 0 {
+		b.WriteString("links:\n")
+	}
+	for _, link := range j.Links {
+		prefix := "  - "
+		for _, field := range [][2]string{{"rel", link.Rel}, {"type", link.Type}, {"href", link.Href}} {
+			if field[1] != "" {
+				fmt.Fprintf(&b, "%s%s: %s\n", prefix, field[0], yamlString(field[1]))
+				prefix = "    "
+			}
+		}
+		if len(link.Titles) > 0 {
+			fmt.Fprintf(&b, "%stitles:\n", prefix)
+			prefix = "    "
+			for _, lang := range sortedStringKeys(link.Titles) {
+				fmt.Fprintf(&b, "      %s: %s\n", yamlString(lang), yamlString(link.Titles[lang]))
+			}
+		}
+		if len(link.Properties) > 0 {
+			fmt.Fprintf(&b, "%sproperties:\n", prefix)
+			prefix = "    "
+			properties("      ", link.Properties)
+		}
+		if prefix == "  - " {
+			b.WriteString("  - {}\n")
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var (
+	// yamlPlain matches the strings which can be written as plain YAML
+	// scalars.  They must not start with an indicator character (e.g. @ or
+	// -), nor with a digit, '.' or a sign, so that numbers of any YAML
+	// version (0x1F, 0o17, 1_000, 1:20, .inf, ...) and timestamps are
+	// quoted.
+	yamlPlain = regexp.MustCompile(`^[A-Za-z_/~][A-Za-z0-9_/.@~+:=?&%,;()*$'-]*$`)
+
+	// yamlReserved matches the plain scalars which YAML 1.1 or 1.2 would
+	// not read as strings.
+	yamlReserved = regexp.MustCompile(`(?i)^(true|false|yes|no|y|n|on|off|null|~)$`)
+)
+
+// yamlString returns s as a YAML scalar, quoted if needed.
+func yamlString(s string) string {
+	if yamlPlain.MatchString(s) && !yamlReserved.MatchString(s) &&
+		!strings.Contains(s, ": ") && !strings.HasSuffix(s, ":") {
+		return s
+	}
+	// JSON strings are valid double-quoted YAML scalars
+	return strconv.Quote(s)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedStringKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ant0ine/go-webfinger/jrd"
+)
+
+var testJRD = &jrd.JRD{
+	Subject:    "acct:bob@example.com",
+	Aliases:    []string{"https://example.com/@bob"},
+	Properties: map[string]interface{}{"http://example.com/ns/role": "admin", "http://example.com/ns/none": nil},
+	Links: []jrd.Link{
+		{
+			Rel:    "http://webfinger.net/rel/profile-page",
+			Type:   "text/html",
+			Href:   "https://example.com/@bob",
+			Titles: map[string]string{"en": "Bob: the profile"},
+		},
+		{Rel: "self", Href: "https://example.com/users/bob"},
+	},
+}
+
+func TestWriteSelection(t *testing.T) {
+	tests := []struct {
+		selector string
+		want     string
+	}{
+		{".subject", "acct:bob@example.com\n"},
+		{".links[0].href", "https://example.com/@bob\n"},
+		{".links[-1].rel", "self\n"},
+		{".links[].rel", "http://webfinger.net/rel/profile-page\nself\n"},
+		{`.properties["http://example.com/ns/role"]`, "admin\n"},
+		{".links[0].titles", `{"en":"Bob: the profile"}` + "\n"},
+		{".missing", "null\n"},
+		{".links[5].href", "null\n"},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		if err := writeSelection(&b, testJRD, tt.selector); err != nil {
+			t.Errorf("writeSelection(%q) returned error %v", tt.selector, err)
+			continue
+		}
+		if b.String() != tt.want {
+			t.Errorf("writeSelection(%q) wrote %q, want %q", tt.selector, b.String(), tt.want)
+		}
+	}
+
+	for _, selector := range []string{"subject", ".links[", ".links[x]", ".subject.foo"} {
+		if err := writeSelection(&bytes.Buffer{}, testJRD, selector); err == nil {
+			t.Errorf("writeSelection(%q) returned no error", selector)
+		}
+	}
+}
+
+func TestWriteYAML(t *testing.T) {
+	var b bytes.Buffer
+	if err := writeYAML(&b, testJRD, false); err != nil {
+		t.Fatal(err)
+	}
+	want := `subject: acct:bob@example.com
+aliases:
+  - https://example.com/@bob
+properties:
+  http://example.com/ns/none: null
+  http://example.com/ns/role: admin
+links:
+  - rel: http://webfinger.net/rel/profile-page
+    type: text/html
+    href: https://example.com/@bob
+    titles:
+      en: "Bob: the profile"
+  - rel: self
+    href: https://example.com/users/bob
+`
+	if b.String() != want {
+		t.Errorf("writeYAML wrote:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestYAMLString(t *testing.T) {
+	tests := []struct {
+		s, want string
+	}{
+		{"acct:bob@example.com", "acct:bob@example.com"},
+		{"https://example.com/@bob", "https://example.com/@bob"},
+		{"~bob", "~bob"},
+		{"@bob", `"@bob"`},
+		{"-bob", `"-bob"`},
+		{"*bob", `"*bob"`},
+		{"~", `"~"`},
+		{"Yes", `"Yes"`},
+		{"n", `"n"`},
+		{"42", `"42"`},
+		{"0x1F", `"0x1F"`},
+		{"0o17", `"0o17"`},
+		{"1_000", `"1_000"`},
+		{"1:20", `"1:20"`},
+		{"2001-12-14", `"2001-12-14"`},
+		{".inf", `".inf"`},
+		{"-.Inf", `"-.Inf"`},
+		{".NaN", `".NaN"`},
+		{"+1", `"+1"`},
+		{"Bob: the profile", `"Bob: the profile"`},
+		{"", `""`},
+	}
+	for _, tt := range tests {
+		if got := yamlString(tt.s); got != tt.want {
+			t.Errorf("yamlString(%q) is %s, want %s", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestWriteFormats(t *testing.T) {
+	for name, write := range formats {
+		var b bytes.Buffer
+		if err := write(&b, testJRD, false); err != nil {
+			t.Errorf("%s: unexpected error %v", name, err)
+			continue
+		}
+		if !strings.Contains(b.String(), "https://example.com/users/bob") {
+			t.Errorf("%s output lacks a link:\n%s", name, b.String())
+		}
+		if strings.Contains(b.String(), "\x1b[") {
+			t.Errorf("%s output is colorized", name)
+		}
+	}
+
+	var b bytes.Buffer
+	writeXRD(&b, testJRD, false)
+	if !strings.Contains(b.String(), `<Title xml:lang="en">Bob: the profile</Title>`) {
+		t.Errorf("XRD output lacks the link title:\n%s", b.String())
+	}
+}
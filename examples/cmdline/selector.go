@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A step of a selector: a field name, an array index, or all the elements of
+// an array or object.
+type step struct {
+	field string
+	index int
+	all   bool
+	isIdx bool
+}
+
+// parseSelector parses a jq-style selector, e.g. ".links[0].href",
+// ".properties[\"http://example.com/ns/role\"]" or ".links[].rel".
+func parseSelector(expr string) ([]step, error) {
+	if !strings.HasPrefix(expr, ".") {
+		return nil, fmt.Errorf("invalid selector %q: must start with '.'", expr)
+	}
+	var steps []step
+	s := expr
+	for s != "" {
+		switch {
+		case s == ".":
+			s = ""
+		case strings.HasPrefix(s, "["):
+			end := strings.Index(s, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid selector %q: missing ']'", expr)
+			}
+			inner := s[1:end]
+			switch {
+			case inner == "":
+				steps = append(steps, step{all: true})
+			case strings.HasPrefix(inner, `"`):
+				field, err := strconv.Unquote(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid selector %q: bad key %s", expr, inner)
+				}
+				steps = append(steps, step{field: field})
+			default:
+				index, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid selector %q: bad index %s", expr, inner)
+				}
+				steps = append(steps, step{index: index, isIdx: true})
+			}
+			s = s[end+1:]
+		case strings.HasPrefix(s, "."):
+			s = s[1:]
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			if end > 0 {
+				steps = append(steps, step{field: s[:end]})
+			} else if !strings.HasPrefix(s, "[") {
+				return nil, fmt.Errorf("invalid selector %q: empty field name", expr)
+			}
+			s = s[end:]
+		default:
+			return nil, fmt.Errorf("invalid selector %q: unexpected %q", expr, s)
+		}
+	}
+	return steps, nil
+}
+
+// selectValues applies a selector to v, a value decoded from JSON, and returns
+// the selected values.  Missing fields and indexes out of range select null,
+// as with jq.
+func selectValues(v interface{}, steps []step) ([]interface{}, error) {
+	values := []interface{}{v}
+	for _, st := range steps {
+		var next []interface{}
+		for _, value := range values {
+			switch {
+			case st.all:
+				switch value := value.(type) {
+				case []interface{}:
+					next = append(next, value...)
+				case map[string]interface{}:
+					for _, k := range sortedKeys(value) {
+						next = append(next, value[k])
+					}
+				case nil:
+				default:
+					return nil, fmt.Errorf("cannot iterate over %s", jsonType(value))
+				}
+			case st.isIdx:
+				switch value := value.(type) {
+				case []interface{}:
+					i := st.index
+					if i < 0 {
+						i += len(value)
+					}
+					if i < 0 || i >= len(value) {
+						next = append(next, nil)
+					} else {
+						next = append(next, value[i])
+					}
+				case nil:
+					next = append(next, nil)
+				default:
+					return nil, fmt.Errorf("cannot index %s with a number", jsonType(value))
+				}
+			default:
+				switch value := value.(type) {
+				case map[string]interface{}:
+					next = append(next, value[st.field])
+				case nil:
+					next = append(next, nil)
+				default:
+					return nil, fmt.Errorf("cannot index %s with %q", jsonType(value), st.field)
+				}
+			}
+		}
+		values = next
+	}
+	return values, nil
+}
+
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return "null"
+}
+
+// writeSelection writes the values of v selected by expr, one per line:
+// strings raw, and other values as JSON.
+func writeSelection(w io.Writer, v interface{}, expr string) error {
+	steps, err := parseSelector(expr)
+	if err != nil {
+		return err
+	}
+
+	// work on the JSON representation, so that field names are the JRD ones
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(bytes, &doc); err != nil {
+		return err
+	}
+
+	values, err := selectValues(doc, steps)
+	if err != nil {
+		return err
+	}
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			fmt.Fprintln(w, s)
+			continue
+		}
+		bytes, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\n", bytes)
+	}
+	return nil
+}
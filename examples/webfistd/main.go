@@ -0,0 +1,26 @@
+// Minimal WebFist delegation server, keeping delegations in memory
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/ant0ine/go-webfinger/webfist"
+)
+
+func main() {
+	addr := flag.String("addr", ":443", "address to listen on")
+	cert := flag.String("cert", "", "TLS certificate file")
+	key := flag.String("key", "", "TLS key file")
+	flag.Parse()
+
+	s := webfist.NewServer(webfist.NewMemoryStore(), net.DefaultResolver)
+
+	log.Printf("Listening on %s", *addr)
+	if *cert != "" {
+		log.Fatal(http.ListenAndServeTLS(*addr, *cert, *key, s))
+	}
+	log.Fatal(http.ListenAndServe(*addr, s))
+}
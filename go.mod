@@ -0,0 +1,3 @@
+module github.com/ant0ine/go-webfinger
+
+go 1.21
@@ -0,0 +1,82 @@
+package webfinger
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// A HostResolver maps the WebFinger host of resources to the endpoint their
+// queries are issued at, for split-horizon deployments, proxies or test
+// servers for example.
+type HostResolver interface {
+	// ResolveHost returns the endpoint of the WebFinger queries for host, or
+	// nil to use the default one.
+	//
+	// If the endpoint has a scheme, queries are only issued with that scheme,
+	// otherwise the SchemePolicy of the Client applies to the endpoint host.
+	// If the endpoint has no path, /.well-known/webfinger is used.
+	ResolveHost(ctx context.Context, host string) (*url.URL, error)
+}
+
+// HostResolverFunc is an adapter to allow the use of ordinary functions as a
+// HostResolver.
+type HostResolverFunc func(ctx context.Context, host string) (*url.URL, error)
+
+// ResolveHost calls f(ctx, host).
+func (f HostResolverFunc) ResolveHost(ctx context.Context, host string) (*url.URL, error) {
+	return f(ctx, host)
+}
+
+// StaticHosts is a HostResolver mapping hosts to fixed endpoints.  Endpoints
+// are either a host with an optional port (e.g. "localhost:8080"), or an
+// absolute URL (e.g. "http://localhost:8080/webfinger").  Hosts not in the
+// map use the default endpoint.
+type StaticHosts map[string]string
+
+// ResolveHost implements HostResolver.
+func (s StaticHosts) ResolveHost(ctx context.Context, host string) (*url.URL, error) {
+	endpoint, ok := s[host]
+	if !ok {
+		for h, e := range s {
+			if strings.EqualFold(h, host) {
+				endpoint, ok = e, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return nil, nil
+	}
+	if !strings.Contains(endpoint, "://") {
+		return &url.URL{Host: endpoint}, nil
+	}
+	return url.Parse(endpoint)
+}
+
+// queryURL returns the URL of the WebFinger query for resource, as mapped by
+// the HostResolver of c.  pinned reports whether the HostResolver set the
+// scheme of the URL, in which case the SchemePolicy of c does not apply.
+func (c *Client) queryURL(ctx context.Context, resource *Resource, rels []string) (u *url.URL, pinned bool, err error) {
+	u = resource.JRDURL("", rels)
+	if c.HostResolver == nil {
+		return u, false, nil
+	}
+
+	endpoint, err := c.HostResolver.ResolveHost(ctx, u.Host)
+	if err != nil || endpoint == nil {
+		return u, false, err
+	}
+
+	if endpoint.Scheme != "" {
+		u.Scheme = endpoint.Scheme
+		pinned = true
+	}
+	if endpoint.Host != "" {
+		u.Host = endpoint.Host
+	}
+	if endpoint.Path != "" {
+		u.Path = endpoint.Path
+	}
+	return u, pinned, nil
+}
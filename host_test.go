@@ -0,0 +1,60 @@
+package webfinger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestHostResolver(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprintf(w, `{"subject":%q}`, r.FormValue("resource"))
+	})
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/webfinger" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprintf(w, `{"subject":%q}`, r.FormValue("resource"))
+	}))
+	defer plain.Close()
+
+	client.WebFistServer = ""
+	client.HostResolver = StaticHosts{
+		"Example.com": testHost,
+		"example.net": plain.URL + "/webfinger",
+	}
+
+	for _, identifier := range []string{"bob@example.com", "bob@example.net"} {
+		result, err := client.LookupWithInfo(identifier, nil)
+		if err != nil {
+			t.Errorf("Lookup of %s returned error: %v", identifier, err)
+			continue
+		}
+		if got, want := result.JRD.Subject, "acct:"+identifier; got != want {
+			t.Errorf("Lookup of %s returned subject %q, want %q", identifier, got, want)
+		}
+	}
+
+	// hosts not mapped use the default endpoint
+	if u, _ := (StaticHosts{}).ResolveHost(context.Background(), "example.org"); u != nil {
+		t.Errorf("ResolveHost returned %v for an unknown host, want nil", u)
+	}
+
+	errResolve := errors.New("no route")
+	client.HostResolver = HostResolverFunc(func(ctx context.Context, host string) (*url.URL, error) {
+		return nil, errResolve
+	})
+	if _, err := client.Lookup("bob@example.com", nil); !errors.Is(err, errResolve) {
+		t.Errorf("Lookup returned error %v, want %v", err, errResolve)
+	}
+}
@@ -0,0 +1,60 @@
+package webfinger
+
+import (
+	"context"
+	"net/url"
+)
+
+// Instrumentation receives the events of the lookups of a Client, to trace
+// them or record metrics.  Each Start method is called when an operation
+// starts, and returns the context used for the operation along with a function
+// called when it ends.
+type Instrumentation interface {
+	// StartLookup is called for each lookup of resource.
+	StartLookup(ctx context.Context, resource *Resource) (context.Context, func(*Result, error))
+
+	// StartFetch is called for each HTTP request fetching a JRD, including
+	// requests to WebFist servers.
+	StartFetch(ctx context.Context, u *url.URL) (context.Context, func(Attempt))
+
+	// StartFallback is called when a lookup falls back to the WebFist
+	// protocol.
+	StartFallback(ctx context.Context, resource *Resource, servers []string) (context.Context, func(error))
+
+	// StartWebFist is called for the lookup of resource on each WebFist
+	// server.
+	StartWebFist(ctx context.Context, resource *Resource, server string) (context.Context, func(error))
+}
+
+// NopInstrumentation is an Instrumentation doing nothing.  It can be embedded
+// by implementations only interested in some events.
+type NopInstrumentation struct{}
+
+// StartLookup implements Instrumentation, returning ctx unchanged.
+func (NopInstrumentation) StartLookup(ctx context.Context, resource *Resource) (context.Context, func(*Result, error)) {
+	return ctx, func(*Result, error) {}
+}
+
+// StartFetch implements Instrumentation, returning ctx unchanged.
+func (NopInstrumentation) StartFetch(ctx context.Context, u *url.URL) (context.Context, func(Attempt)) {
+	return ctx, func(Attempt) {}
+}
+
+// StartFallback implements Instrumentation, returning ctx unchanged.
+func (NopInstrumentation) StartFallback(ctx context.Context, resource *Resource, servers []string) (context.Context, func(error)) {
+	return ctx, func(error) {}
+}
+
+// StartWebFist implements Instrumentation, returning ctx unchanged.
+func (NopInstrumentation) StartWebFist(ctx context.Context, resource *Resource, server string) (context.Context, func(error)) {
+	return ctx, func(error) {}
+}
+
+// instrumentation returns the Instrumentation of c, or NopInstrumentation if
+// none is set.
+func (c *Client) instrumentation() Instrumentation {
+	if c.Instrumentation != nil {
+		return c.Instrumentation
+	}
+	return NopInstrumentation{}
+}
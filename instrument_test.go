@@ -0,0 +1,81 @@
+package webfinger
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// eventRecorder is an Instrumentation recording the events it receives.
+type eventRecorder struct {
+	NopInstrumentation
+
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *eventRecorder) record(event string) {
+	r.mu.Lock()
+	r.events = append(r.events, event)
+	r.mu.Unlock()
+}
+
+func (r *eventRecorder) StartLookup(ctx context.Context, resource *Resource) (context.Context, func(*Result, error)) {
+	r.record("lookup")
+	return ctx, func(result *Result, err error) {
+		r.record(fmt.Sprintf("lookup end: %v", err == nil))
+	}
+}
+
+func (r *eventRecorder) StartFetch(ctx context.Context, u *url.URL) (context.Context, func(Attempt)) {
+	r.record("fetch")
+	return ctx, func(a Attempt) {
+		r.record(fmt.Sprintf("fetch end: %d", a.StatusCode))
+	}
+}
+
+func (r *eventRecorder) StartFallback(ctx context.Context, resource *Resource, servers []string) (context.Context, func(error)) {
+	r.record("fallback")
+	return ctx, func(err error) {
+		r.record(fmt.Sprintf("fallback end: %v", err == nil))
+	}
+}
+
+func TestInstrumentation(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("resource") != "acct:bob@"+testHost {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	})
+
+	rec := &eventRecorder{}
+	client.Instrumentation = rec
+	client.WebFistServer = testHost
+
+	if _, err := client.Lookup("bob@"+testHost, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := client.Lookup("alice@"+testHost, nil); err == nil {
+		t.Fatal("Expected error")
+	}
+
+	want := []string{
+		"lookup", "fetch", "fetch end: 200", "lookup end: true",
+		"lookup", "fetch", "fetch end: 404",
+		"fallback", "fetch", "fetch end: 404", "fallback end: false",
+		"lookup end: false",
+	}
+	if !reflect.DeepEqual(rec.events, want) {
+		t.Errorf("Recorded events %q, want %q", rec.events, want)
+	}
+}
@@ -0,0 +1,121 @@
+package jrd
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Link relation types commonly found in WebFinger responses.
+const (
+	// RelSelf links to the resource itself, typically an ActivityPub actor.
+	RelSelf = "self"
+
+	// RelProfilePage links to the HTML profile page of the subject.
+	RelProfilePage = "http://webfinger.net/rel/profile-page"
+
+	// RelAvatar links to an image representing the subject.
+	RelAvatar = "http://webfinger.net/rel/avatar"
+
+	// RelOpenIDIssuer links to the OpenID Connect issuer of the subject, see
+	// OpenID Connect Discovery 1.0 section 2.
+	RelOpenIDIssuer = "http://openid.net/specs/connect/1.0/issuer"
+
+	// RelRemoteStorage links to the remoteStorage server of the subject.
+	RelRemoteStorage = "http://tools.ietf.org/id/draft-dejong-remotestorage"
+
+	// RelOStatusSubscribe links to the OStatus remote follow template.
+	RelOStatusSubscribe = "http://ostatus.org/schema/1.0/subscribe"
+
+	// RelDiasporaHCard links to the Diaspora hCard of the subject.
+	RelDiasporaHCard = "http://microformats.org/profile/hcard"
+
+	// RelDiasporaSeedLocation links to the Diaspora pod of the subject.
+	RelDiasporaSeedLocation = "http://joindiaspora.com/seed_location"
+
+	// RelSalmon links to the Salmon endpoint of the subject.
+	RelSalmon = "salmon"
+
+	// RelMagicPublicKey links to the Magic Signatures public key of the
+	// subject, as a data: URI.
+	RelMagicPublicKey = "magic-public-key"
+)
+
+// RelNames maps the link relation types above to short, human readable names.
+var RelNames = map[string]string{
+	RelSelf:                 "self",
+	RelProfilePage:          "profile-page",
+	RelAvatar:               "avatar",
+	RelOpenIDIssuer:         "openid-issuer",
+	RelRemoteStorage:        "remotestorage",
+	RelOStatusSubscribe:     "ostatus-subscribe",
+	RelDiasporaHCard:        "hcard",
+	RelDiasporaSeedLocation: "seed-location",
+	RelSalmon:               "salmon",
+	RelMagicPublicKey:       "magic-public-key",
+}
+
+// ErrNoLink is returned by the typed link accessors when the JRD has no link
+// with the requested rel value.
+var ErrNoLink = errors.New("jrd: no such link")
+
+// LinkURL returns the href of the first link with the specified rel value.
+// The href must be an absolute http or https URL.
+func (jrd *JRD) LinkURL(rel string) (*url.URL, error) {
+	return linkURL(jrd.GetLinkByRel(rel))
+}
+
+// Avatar returns the URL of the avatar of the subject.
+func (jrd *JRD) Avatar() (*url.URL, error) {
+	return jrd.LinkURL(RelAvatar)
+}
+
+// ProfilePage returns the URL of the profile page of the subject.
+func (jrd *JRD) ProfilePage() (*url.URL, error) {
+	return jrd.LinkURL(RelProfilePage)
+}
+
+// ActivityPubActor returns the URL of the ActivityPub actor of the subject,
+// that is the href of the self link typed as an ActivityStreams document.
+func (jrd *JRD) ActivityPubActor() (*url.URL, error) {
+	return linkURL(jrd.ActorLink(false))
+}
+
+// ActorLink returns the self link typed as an ActivityStreams document.  If
+// there is none and untyped is true, the first self link is returned instead,
+// for servers which omit the type.  It returns nil if no link matches.
+func (jrd *JRD) ActorLink(untyped bool) *Link {
+	for _, link := range jrd.Links {
+		if link.Rel == RelSelf && IsActivityStreamsType(link.Type) {
+			return &link
+		}
+	}
+	if untyped {
+		return jrd.GetLinkByRel(RelSelf)
+	}
+	return nil
+}
+
+// IsActivityStreamsType reports whether the media type t designates an
+// ActivityStreams document.
+func IsActivityStreamsType(t string) bool {
+	t = strings.ToLower(t)
+	return strings.HasPrefix(t, "application/activity+json") ||
+		(strings.HasPrefix(t, "application/ld+json") &&
+			strings.Contains(t, "https://www.w3.org/ns/activitystreams"))
+}
+
+func linkURL(link *Link) (*url.URL, error) {
+	if link == nil {
+		return nil, ErrNoLink
+	}
+	u, err := url.Parse(link.Href)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("jrd: %s link is not an absolute http URL: %q", link.Rel, link.Href)
+	}
+	return u, nil
+}
@@ -0,0 +1,72 @@
+package jrd
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestJRD_typedLinks(t *testing.T) {
+	obj := &JRD{Links: []Link{
+		{Rel: RelProfilePage, Type: "text/html", Href: "https://example.com/@bob"},
+		{Rel: RelAvatar, Type: "image/png", Href: "https://example.com/bob.png"},
+		{Rel: RelSelf, Type: "text/html", Href: "https://example.com/@bob"},
+		{Rel: RelSelf, Type: `application/ld+json; profile="https://www.w3.org/ns/activitystreams"`, Href: "https://example.com/users/bob"},
+		{Rel: RelSalmon, Href: "/salmon/bob"},
+	}}
+
+	tests := []struct {
+		name string
+		get  func() (*url.URL, error)
+		want string
+	}{
+		{"Avatar", obj.Avatar, "https://example.com/bob.png"},
+		{"ProfilePage", obj.ProfilePage, "https://example.com/@bob"},
+		{"ActivityPubActor", obj.ActivityPubActor, "https://example.com/users/bob"},
+	}
+	for _, tt := range tests {
+		got, err := tt.get()
+		if err != nil {
+			t.Errorf("%s() returned error: %v", tt.name, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("%s() returned %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := obj.LinkURL(RelSalmon); err == nil {
+		t.Error("LinkURL(RelSalmon) returned no error for a relative href")
+	}
+	if _, err := obj.LinkURL(RelOpenIDIssuer); err != ErrNoLink {
+		t.Errorf("LinkURL(RelOpenIDIssuer) returned error %v, want %v", err, ErrNoLink)
+	}
+}
+
+func TestJRD_ActivityPubActor_untyped(t *testing.T) {
+	obj := &JRD{Links: []Link{
+		{Rel: RelSelf, Type: "text/html", Href: "https://example.com/@bob"},
+	}}
+	if _, err := obj.ActivityPubActor(); err != ErrNoLink {
+		t.Errorf("ActivityPubActor() returned error %v, want %v", err, ErrNoLink)
+	}
+}
+
+func TestJRD_ActorLink(t *testing.T) {
+	obj := &JRD{Links: []Link{
+		{Rel: RelSelf, Type: "text/html", Href: "https://example.com/@bob"},
+		{Rel: RelSelf, Type: `application/ld+json; profile="https://www.w3.org/ns/activitystreams"`, Href: "https://example.com/users/bob"},
+	}}
+	if link := obj.ActorLink(false); link == nil || link.Href != "https://example.com/users/bob" {
+		t.Errorf("ActorLink(false) returned %#v, want the ld+json self link", link)
+	}
+
+	obj = &JRD{Links: []Link{
+		{Rel: RelSelf, Type: "text/html", Href: "https://example.com/@bob"},
+	}}
+	if link := obj.ActorLink(false); link != nil {
+		t.Errorf("ActorLink(false) returned %#v for a text/html self link, want nil", link)
+	}
+	if link := obj.ActorLink(true); link == nil || link.Href != "https://example.com/@bob" {
+		t.Errorf("ActorLink(true) returned %#v, want the text/html self link", link)
+	}
+}
@@ -0,0 +1,166 @@
+package jrd
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// SignatureHeader is the HTTP response header holding the detached JWS
+// signature of a JRD.  It is a non-standard extension: neither RFC 7033 nor
+// any other spec defines JRD signatures, so only servers and clients agreeing
+// on it out of band use it.
+const SignatureHeader = "JRD-Signature"
+
+// Supported JWS signature algorithms.
+const (
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Signature is a JWS signature with detached content (RFC 7515 appendix F),
+// computed over the raw bytes of a JRD document.
+type Signature struct {
+	// Alg is the signature algorithm.
+	Alg string `json:"alg"`
+
+	// KeyID identifies the key used to sign, if provided by the signer.
+	KeyID string `json:"kid,omitempty"`
+
+	protected string
+	value     []byte
+}
+
+// ParseSignature parses a detached JWS in its compact serialization
+// ("<protected header>..<signature>").
+func ParseSignature(s string) (*Signature, error) {
+	parts := strings.Split(strings.TrimSpace(s), ".")
+	if len(parts) != 3 || parts[1] != "" {
+		return nil, errors.New("jrd: signature is not a detached JWS")
+	}
+
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("jrd: invalid signature header: %v", err)
+	}
+	sig := Signature{}
+	if err := json.Unmarshal(header, &sig); err != nil {
+		return nil, fmt.Errorf("jrd: invalid signature header: %v", err)
+	}
+	sig.value, err = base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("jrd: invalid signature value: %v", err)
+	}
+	sig.protected = parts[0]
+	return &sig, nil
+}
+
+// Verify checks that sig is a valid signature of content made with key.
+func (sig *Signature) Verify(content []byte, key crypto.PublicKey) error {
+	hashed := sha256.Sum256(signingInput(sig.protected, content))
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if sig.Alg == AlgRS256 {
+			return rsa.VerifyPKCS1v15(k, crypto.SHA256, hashed[:], sig.value)
+		}
+	case *ecdsa.PublicKey:
+		if sig.Alg == AlgES256 {
+			if k.Curve != elliptic.P256() {
+				return fmt.Errorf("jrd: ES256 requires a P-256 key, not %s", k.Params().Name)
+			}
+			if len(sig.value) != 64 {
+				return errors.New("jrd: invalid ES256 signature length")
+			}
+			r := new(big.Int).SetBytes(sig.value[:32])
+			s := new(big.Int).SetBytes(sig.value[32:])
+			if !ecdsa.Verify(k, hashed[:], r, s) {
+				return errors.New("jrd: invalid ES256 signature")
+			}
+			return nil
+		}
+	case ed25519.PublicKey:
+		if sig.Alg == AlgEdDSA {
+			if !ed25519.Verify(k, signingInput(sig.protected, content), sig.value) {
+				return errors.New("jrd: invalid EdDSA signature")
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("jrd: algorithm %s does not match key type %T", sig.Alg, key)
+}
+
+// Sign returns the detached JWS of content, made with key and identified by
+// keyID.  RSA, ECDSA P-256 and Ed25519 keys are supported.
+func Sign(content []byte, key crypto.Signer, keyID string) (string, error) {
+	sig := Signature{KeyID: keyID}
+	switch pub := key.Public().(type) {
+	case *rsa.PublicKey:
+		sig.Alg = AlgRS256
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return "", fmt.Errorf("jrd: unsupported ECDSA curve %s", pub.Params().Name)
+		}
+		sig.Alg = AlgES256
+	case ed25519.PublicKey:
+		sig.Alg = AlgEdDSA
+	default:
+		return "", fmt.Errorf("jrd: unsupported key type %T", key.Public())
+	}
+
+	header, err := json.Marshal(sig)
+	if err != nil {
+		return "", err
+	}
+	protected := base64.RawURLEncoding.EncodeToString(header)
+	input := signingInput(protected, content)
+
+	var value []byte
+	switch sig.Alg {
+	case AlgEdDSA:
+		value, err = key.Sign(rand.Reader, input, crypto.Hash(0))
+	case AlgES256:
+		hashed := sha256.Sum256(input)
+		value, err = key.Sign(rand.Reader, hashed[:], crypto.SHA256)
+		if err == nil {
+			value, err = rawECDSASignature(value)
+		}
+	default:
+		hashed := sha256.Sum256(input)
+		value, err = key.Sign(rand.Reader, hashed[:], crypto.SHA256)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return protected + ".." + base64.RawURLEncoding.EncodeToString(value), nil
+}
+
+// rawECDSASignature converts an ASN.1 encoded P-256 signature to the fixed
+// size format used by JWS.
+func rawECDSASignature(der []byte) ([]byte, error) {
+	var rs struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(der, &rs); err != nil {
+		return nil, err
+	}
+	value := make([]byte, 64)
+	rs.R.FillBytes(value[:32])
+	rs.S.FillBytes(value[32:])
+	return value, nil
+}
+
+func signingInput(protected string, content []byte) []byte {
+	return []byte(protected + "." + base64.RawURLEncoding.EncodeToString(content))
+}
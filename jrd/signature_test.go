@@ -0,0 +1,76 @@
+package jrd
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"testing"
+)
+
+func TestSignature(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	content := []byte(`{"subject":"acct:bob@example.com"}`)
+	for _, key := range []crypto.Signer{rsaKey, ecKey, edKey} {
+		s, err := Sign(content, key, "key-1")
+		if err != nil {
+			t.Fatalf("Sign returned error for %T: %v", key, err)
+		}
+
+		sig, err := ParseSignature(s)
+		if err != nil {
+			t.Fatalf("ParseSignature(%q) returned error: %v", s, err)
+		}
+		if got, want := sig.KeyID, "key-1"; got != want {
+			t.Errorf("KeyID is %q, want %q", got, want)
+		}
+		if err := sig.Verify(content, key.Public()); err != nil {
+			t.Errorf("Verify returned error for %s: %v", sig.Alg, err)
+		}
+		if err := sig.Verify([]byte(`{"subject":"acct:mallory@example.com"}`), key.Public()); err == nil {
+			t.Errorf("Verify returned no error for tampered %s content", sig.Alg)
+		}
+	}
+}
+
+func TestSignature_wrongKeyType(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	content := []byte(`{}`)
+	s, _ := Sign(content, rsaKey, "")
+	sig, _ := ParseSignature(s)
+	if err := sig.Verify(content, ecKey.Public()); err == nil {
+		t.Error("Verify returned no error for mismatched key type")
+	}
+}
+
+func TestParseSignature_error(t *testing.T) {
+	for _, s := range []string{"", "a.b.c", "e30..!!", "!!..c2ln"} {
+		if _, err := ParseSignature(s); err == nil {
+			t.Errorf("ParseSignature(%q) returned no error", s)
+		}
+	}
+}
+
+func TestSignature_curve(t *testing.T) {
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if _, err := Sign([]byte(`{}`), p384, ""); err == nil {
+		t.Error("Sign returned no error for a P-384 key")
+	}
+
+	// an ES256 signature checked against a P-384 key
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	s, _ := Sign([]byte(`{}`), p256, "")
+	sig, _ := ParseSignature(s)
+	err := sig.Verify([]byte(`{}`), &p384.PublicKey)
+	if err == nil || !strings.Contains(err.Error(), "P-256") {
+		t.Errorf("Verify returned error %v for a P-384 key, want a curve error", err)
+	}
+}
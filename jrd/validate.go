@@ -0,0 +1,85 @@
+package jrd
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// A ValidationError lists the problems making a JRD invalid.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid JRD: " + strings.Join(e.Problems, "; ")
+}
+
+// registeredRel matches the link relation types registered with IANA, which
+// are not URIs.
+var registeredRel = regexp.MustCompile(`^[a-z][a-z0-9.\-]*$`)
+
+// Validate checks that jrd follows RFC 7033 section 4.4: the subject, aliases
+// and property names are absolute URIs, property values are strings or null,
+// and links have a rel which is either a registered relation type or an
+// absolute URI, and an absolute href if any.  It returns a *ValidationError
+// listing the problems found.
+func (jrd *JRD) Validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if jrd.Subject != "" && !isAbsoluteURI(jrd.Subject) {
+		add("subject %q is not an absolute URI", jrd.Subject)
+	}
+	for _, alias := range jrd.Aliases {
+		if !isAbsoluteURI(alias) {
+			add("alias %q is not an absolute URI", alias)
+		}
+	}
+	validateProperties(jrd.Properties, "", add)
+
+	for i, link := range jrd.Links {
+		prefix := fmt.Sprintf("link %d: ", i)
+		switch {
+		case link.Rel == "":
+			add("%smissing rel", prefix)
+		case !registeredRel.MatchString(link.Rel) && !isAbsoluteURI(link.Rel):
+			add(prefix+"rel %q is neither a registered relation type nor an absolute URI", link.Rel)
+		}
+		if link.Href != "" && !isAbsoluteURI(link.Href) {
+			add(prefix+"href %q is not an absolute URI", link.Href)
+		}
+		for lang := range link.Titles {
+			if lang == "" {
+				add("%stitle without language tag", prefix)
+			}
+		}
+		validateProperties(link.Properties, prefix, add)
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{problems}
+	}
+	return nil
+}
+
+func validateProperties(properties map[string]interface{}, prefix string, add func(string, ...interface{})) {
+	for name, value := range properties {
+		if !isAbsoluteURI(name) {
+			add(prefix+"property name %q is not an absolute URI", name)
+		}
+		switch value.(type) {
+		case string, nil:
+		default:
+			add(prefix+"property %q is not a string or null", name)
+		}
+	}
+}
+
+func isAbsoluteURI(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != ""
+}
@@ -0,0 +1,38 @@
+package jrd
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestJRD_Validate(t *testing.T) {
+	valid := &JRD{
+		Subject:    "acct:bob@example.com",
+		Aliases:    []string{"https://example.com/@bob"},
+		Properties: map[string]interface{}{"http://example.com/ns/role": "admin", "http://example.com/ns/none": nil},
+		Links: []Link{
+			{Rel: RelSelf, Href: "https://example.com/users/bob", Titles: map[string]string{"und": "Bob"}},
+			{Rel: RelProfilePage, Href: "https://example.com/@bob"},
+		},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate returned error: %v", err)
+	}
+
+	invalid := &JRD{
+		Subject:    "bob@example.com",
+		Properties: map[string]interface{}{"role": 42.0},
+		Links: []Link{
+			{Href: "https://example.com/@bob"},
+			{Rel: "Not a rel", Href: "/relative"},
+		},
+	}
+	err := invalid.Validate()
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Validate returned error %v, want a *ValidationError", err)
+	}
+	if got, want := len(verr.Problems), 6; got != want {
+		t.Errorf("Validate found %d problems %q, want %d", got, verr.Problems, want)
+	}
+}
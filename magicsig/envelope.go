@@ -0,0 +1,192 @@
+package magicsig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// Namespace is the XML namespace of Magic Envelopes.
+	Namespace = "http://salmon-protocol.org/ns/magic-env"
+
+	// Encoding is the only data encoding defined for Magic Envelopes.
+	Encoding = "base64url"
+
+	// AlgRSASHA256 is the only signature algorithm defined for Magic
+	// Envelopes.
+	AlgRSASHA256 = "RSA-SHA256"
+)
+
+// ErrVerification is returned by Envelope.Verify when no signature of the
+// envelope matches the key.
+var ErrVerification = errors.New("magicsig: signature verification failed")
+
+// Envelope is a Magic Envelope, holding signed data.
+type Envelope struct {
+	// Data is the base64url encoded payload, as it appears in the envelope.
+	Data     string      `json:"data"`
+	DataType string      `json:"data_type"`
+	Encoding string      `json:"encoding"`
+	Alg      string      `json:"alg"`
+	Sigs     []Signature `json:"sigs"`
+}
+
+// Signature is a signature of an Envelope.
+type Signature struct {
+	Value string `json:"value"`
+	KeyID string `json:"keyhash,omitempty"`
+}
+
+type xmlEnvelope struct {
+	XMLName xml.Name `xml:"http://salmon-protocol.org/ns/magic-env env"`
+	Data    struct {
+		Type  string `xml:"type,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"data"`
+	Encoding string         `xml:"encoding"`
+	Alg      string         `xml:"alg"`
+	Sigs     []xmlSignature `xml:"sig"`
+}
+
+type xmlSignature struct {
+	KeyID string `xml:"key_id,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+// ParseEnvelope parses a Magic Envelope in its XML or JSON serialization.
+func ParseEnvelope(blob []byte) (*Envelope, error) {
+	blob = bytes.TrimSpace(blob)
+	if bytes.HasPrefix(blob, []byte("{")) {
+		env := Envelope{}
+		if err := json.Unmarshal(blob, &env); err != nil {
+			return nil, err
+		}
+		return &env, nil
+	}
+
+	x := xmlEnvelope{}
+	if err := xml.Unmarshal(blob, &x); err != nil {
+		return nil, err
+	}
+	env := &Envelope{
+		Data:     x.Data.Value,
+		DataType: x.Data.Type,
+		Encoding: strings.TrimSpace(x.Encoding),
+		Alg:      strings.TrimSpace(x.Alg),
+	}
+	for _, sig := range x.Sigs {
+		env.Sigs = append(env.Sigs, Signature{Value: sig.Value, KeyID: sig.KeyID})
+	}
+	return env, nil
+}
+
+// XML returns the XML serialization of e.
+func (e *Envelope) XML() ([]byte, error) {
+	x := xmlEnvelope{Encoding: e.Encoding, Alg: e.Alg}
+	x.Data.Type = e.DataType
+	x.Data.Value = e.Data
+	for _, sig := range e.Sigs {
+		x.Sigs = append(x.Sigs, xmlSignature{sig.KeyID, sig.Value})
+	}
+	return xml.Marshal(x)
+}
+
+// Payload returns the decoded data of e.
+func (e *Envelope) Payload() ([]byte, error) {
+	if e.Encoding != Encoding {
+		return nil, fmt.Errorf("magicsig: unsupported encoding: %s", e.Encoding)
+	}
+	return decode(stripSpace(e.Data))
+}
+
+// Verify checks that one of the signatures of e was made with key.
+func (e *Envelope) Verify(key *rsa.PublicKey) error {
+	if e.Alg != AlgRSASHA256 {
+		return fmt.Errorf("magicsig: unsupported algorithm: %s", e.Alg)
+	}
+	if e.Encoding != Encoding {
+		return fmt.Errorf("magicsig: unsupported encoding: %s", e.Encoding)
+	}
+
+	hashed := sha256.Sum256([]byte(e.signedString()))
+	keyID := KeyID(key)
+	for _, sig := range e.Sigs {
+		if sig.KeyID != "" && sig.KeyID != keyID {
+			continue
+		}
+		value, err := decode(stripSpace(sig.Value))
+		if err != nil {
+			continue
+		}
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], value) == nil {
+			return nil
+		}
+	}
+	return ErrVerification
+}
+
+// Sign returns an envelope holding data of type dataType, signed with key.
+func Sign(data []byte, dataType string, key *rsa.PrivateKey) (*Envelope, error) {
+	e := &Envelope{
+		Data:     base64.URLEncoding.EncodeToString(data),
+		DataType: dataType,
+		Encoding: Encoding,
+		Alg:      AlgRSASHA256,
+	}
+
+	hashed := sha256.Sum256([]byte(e.signedString()))
+	value, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return nil, err
+	}
+	e.Sigs = []Signature{{
+		Value: base64.URLEncoding.EncodeToString(value),
+		KeyID: KeyID(&key.PublicKey),
+	}}
+	return e, nil
+}
+
+// Author returns the URI of the author of the Atom entry carried by e, which
+// identifies the key the envelope should be verified with.
+func (e *Envelope) Author() (string, error) {
+	payload, err := e.Payload()
+	if err != nil {
+		return "", err
+	}
+
+	entry := struct {
+		Author struct {
+			URI string `xml:"uri"`
+		} `xml:"author"`
+	}{}
+	if err := xml.Unmarshal(payload, &entry); err != nil {
+		return "", err
+	}
+	if entry.Author.URI == "" {
+		return "", errors.New("magicsig: no author in entry")
+	}
+	return strings.TrimSpace(entry.Author.URI), nil
+}
+
+// signedString returns the signature base string of e.
+func (e *Envelope) signedString() string {
+	return strings.Join([]string{
+		stripSpace(e.Data),
+		base64.URLEncoding.EncodeToString([]byte(e.DataType)),
+		base64.URLEncoding.EncodeToString([]byte(e.Encoding)),
+		base64.URLEncoding.EncodeToString([]byte(e.Alg)),
+	}, ".")
+}
+
+func stripSpace(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
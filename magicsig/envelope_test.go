@@ -0,0 +1,110 @@
+package magicsig
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestEnvelope_signVerify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte(`<entry xmlns="http://www.w3.org/2005/Atom"><author><uri>acct:bob@example.com</uri></author></entry>`)
+	env, err := Sign(data, "application/atom+xml", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// round trip through both serializations
+	x, err := env.XML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := json.Marshal(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, blob := range [][]byte{x, j} {
+		parsed, err := ParseEnvelope(blob)
+		if err != nil {
+			t.Fatalf("ParseEnvelope(%s) returned error: %v", blob, err)
+		}
+		if err := parsed.Verify(&key.PublicKey); err != nil {
+			t.Errorf("Verify returned error: %v", err)
+		}
+		if err := parsed.Verify(&other.PublicKey); err != ErrVerification {
+			t.Errorf("Verify with other key returned %v, want %v", err, ErrVerification)
+		}
+		payload, err := parsed.Payload()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(payload) != string(data) {
+			t.Errorf("Payload returned %q, want %q", payload, data)
+		}
+		author, err := parsed.Author()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "acct:bob@example.com"; author != want {
+			t.Errorf("Author returned %q, want %q", author, want)
+		}
+	}
+}
+
+func TestEnvelope_Verify_tampered(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := Sign([]byte("hello"), "text/plain", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env.DataType = "text/html"
+	if err := env.Verify(&key.PublicKey); err != ErrVerification {
+		t.Errorf("Verify returned %v, want %v", err, ErrVerification)
+	}
+}
+
+func TestParseEnvelope_wrappedData(t *testing.T) {
+	blob := `<?xml version='1.0' encoding='UTF-8'?>
+<me:env xmlns:me="http://salmon-protocol.org/ns/magic-env">
+  <me:data type="text/plain">
+    aGVs
+    bG8=
+  </me:data>
+  <me:encoding>base64url</me:encoding>
+  <me:alg>RSA-SHA256</me:alg>
+  <me:sig key_id="4k8ikoyC2Xh+8BiIeQ+ob7Hcd2J7/Vj3uM61dy9iRMI=">c2ln</me:sig>
+</me:env>`
+
+	env, err := ParseEnvelope([]byte(blob))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := env.Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(payload), "hello"; got != want {
+		t.Errorf("Payload returned %q, want %q", got, want)
+	}
+	if got, want := env.DataType, "text/plain"; got != want {
+		t.Errorf("DataType is %q, want %q", got, want)
+	}
+	if len(env.Sigs) != 1 || !strings.HasPrefix(env.Sigs[0].KeyID, "4k8i") {
+		t.Errorf("Sigs is %#v, want one signature", env.Sigs)
+	}
+}
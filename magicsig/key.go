@@ -0,0 +1,118 @@
+// Package magicsig implements the Magic Signatures public key format and the
+// Magic Envelope used by Salmon and OStatus servers.
+//
+// Following this spec: http://salmon-protocol.googlecode.com/svn/trunk/draft-panzer-magicsig-01.html
+package magicsig
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+
+	"github.com/ant0ine/go-webfinger"
+	"github.com/ant0ine/go-webfinger/jrd"
+)
+
+// MediaType is the media type of data: URIs holding a magic public key.
+const MediaType = "application/magic-public-key"
+
+// ParsePublicKey parses an RSA public key in the Magic Signatures format,
+// either bare ("RSA.<modulus>.<exponent>") or wrapped in a data: URI, as
+// published in magic-public-key links.
+func ParsePublicKey(s string) (*rsa.PublicKey, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "data:") {
+		comma := strings.Index(s, ",")
+		if comma < 0 {
+			return nil, errors.New("magicsig: invalid data URI")
+		}
+		mediaType := strings.TrimPrefix(s[:comma], "data:")
+		if mediaType != MediaType {
+			return nil, fmt.Errorf("magicsig: invalid data URI media type: %s", mediaType)
+		}
+		data, err := url.PathUnescape(s[comma+1:])
+		if err != nil {
+			return nil, err
+		}
+		s = data
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 || parts[0] != "RSA" {
+		return nil, errors.New("magicsig: invalid public key, want RSA.<modulus>.<exponent>")
+	}
+	n, err := decode(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("magicsig: invalid modulus: %v", err)
+	}
+	e, err := decode(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("magicsig: invalid exponent: %v", err)
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("magicsig: invalid exponent")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
+
+// FormatPublicKey encodes key in the Magic Signatures format.
+func FormatPublicKey(key *rsa.PublicKey) string {
+	return "RSA." + base64.URLEncoding.EncodeToString(key.N.Bytes()) + "." +
+		base64.URLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+}
+
+// KeyID returns the key id of key, the base64url encoded SHA-256 hash of its
+// Magic Signatures format.
+func KeyID(key *rsa.PublicKey) string {
+	sum := sha256.Sum256([]byte(FormatPublicKey(key)))
+	return base64.URLEncoding.EncodeToString(sum[:])
+}
+
+// PublicKeyFromJRD returns the key published in the magic-public-key link of
+// j.
+func PublicKeyFromJRD(j *jrd.JRD) (*rsa.PublicKey, error) {
+	link := j.GetLinkByRel(jrd.RelMagicPublicKey)
+	if link == nil {
+		return nil, jrd.ErrNoLink
+	}
+	return ParsePublicKey(link.Href)
+}
+
+// LookupPublicKey looks up identifier with c, and returns its magic public key.
+func LookupPublicKey(c *webfinger.Client, identifier string) (*rsa.PublicKey, error) {
+	resourceJRD, err := c.Lookup(identifier, []string{jrd.RelMagicPublicKey})
+	if err != nil {
+		return nil, err
+	}
+	return PublicKeyFromJRD(resourceJRD)
+}
+
+// decode decodes base64url data, with or without padding.
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// VerifySalmon authenticates a Salmon message: the magic public key of the
+// author of the entry carried by env is looked up with c, and env is verified
+// with it.  The author URI is returned.
+func VerifySalmon(c *webfinger.Client, env *Envelope) (string, error) {
+	author, err := env.Author()
+	if err != nil {
+		return "", err
+	}
+	key, err := LookupPublicKey(c, author)
+	if err != nil {
+		return "", err
+	}
+	if err := env.Verify(key); err != nil {
+		return "", err
+	}
+	return author, nil
+}
@@ -0,0 +1,97 @@
+package magicsig
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/ant0ine/go-webfinger"
+	"github.com/ant0ine/go-webfinger/jrd"
+)
+
+// Example key from the Magic Signatures spec.
+const specKey = "RSA.mVgY8RN6URBTstndvmUUPb4UZTdwvwmddSKE5z_jvKUEK6yk1u3rrC9yN8k6FilGj9K0eeUPe2hf4Pj-5CmHww==.AQAB"
+
+func TestParsePublicKey(t *testing.T) {
+	for _, s := range []string{specKey, "data:" + MediaType + "," + specKey} {
+		key, err := ParsePublicKey(s)
+		if err != nil {
+			t.Errorf("ParsePublicKey(%q) returned error: %v", s, err)
+			continue
+		}
+		if key.E != 65537 {
+			t.Errorf("ParsePublicKey(%q) returned exponent %d, want 65537", s, key.E)
+		}
+		if got, want := key.N.BitLen(), 512; got != want {
+			t.Errorf("ParsePublicKey(%q) returned a %d bits modulus, want %d", s, got, want)
+		}
+		if got := FormatPublicKey(key); got != specKey {
+			t.Errorf("FormatPublicKey returned %q, want %q", got, specKey)
+		}
+	}
+}
+
+func TestParsePublicKey_error(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"RSA.AQAB",
+		"DSA.AQAB.AQAB",
+		"data:text/plain," + specKey,
+		"RSA.mVgY8RN6URBTstndvmUUPb4UZTdwvwmddSKE5z_jvKUEK6yk1u3rrC9yN8k6FilGj9K0eeUPe2hf4Pj-5CmHww==.!!",
+	} {
+		if _, err := ParsePublicKey(s); err == nil {
+			t.Errorf("ParsePublicKey(%q) returned no error", s)
+		}
+	}
+}
+
+func TestLookupPublicKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	server := httptest.NewTLSServer(mux)
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprintf(w, `{"links": [{"rel": %q, "href": "data:%s,%s"}]}`,
+			jrd.RelMagicPublicKey, MediaType, FormatPublicKey(&key.PublicKey))
+	})
+
+	client := webfinger.NewClient(&http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	})
+
+	got, err := LookupPublicKey(client, "bob@"+u.Host)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, &key.PublicKey) {
+		t.Errorf("LookupPublicKey returned %#v, want %#v", got, &key.PublicKey)
+	}
+
+	entry := fmt.Sprintf(`<entry xmlns="http://www.w3.org/2005/Atom"><author><uri>acct:bob@%s</uri></author></entry>`, u.Host)
+	env, err := Sign([]byte(entry), "application/atom+xml", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	author, err := VerifySalmon(client, env)
+	if err != nil {
+		t.Fatalf("Unexpected error verifying salmon: %v", err)
+	}
+	if want := "acct:bob@" + u.Host; author != want {
+		t.Errorf("VerifySalmon returned author %q, want %q", author, want)
+	}
+}
@@ -0,0 +1,66 @@
+package webfinger
+
+import (
+	"net/http"
+)
+
+// DefaultUserAgent is the User-Agent of the requests of Clients without a
+// UserAgent.
+const DefaultUserAgent = "go-webfinger (+https://github.com/ant0ine/go-webfinger)"
+
+// A Middleware wraps the http.RoundTripper issuing the requests of a Client,
+// to add headers, record or rewrite requests for example.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc is an adapter to allow the use of ordinary functions as an
+// http.RoundTripper.
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+// RoundTrip calls f(req).
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// userAgent sets the User-Agent of requests which have none.
+func userAgent(ua string, next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("User-Agent") != "" {
+			return next.RoundTrip(req)
+		}
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", ua)
+		return next.RoundTrip(req)
+	})
+}
+
+// httpClient returns the HTTP client used to issue requests: the client of c,
+// with its Middleware, UserAgent and RedirectPolicy.  It is built for each
+// call, so that changes to the client of c (its Transport, Timeout, Jar or
+// CheckRedirect) or to the configuration of c apply to the next requests.  The
+// User-Agent is set once the requests went through Middleware, so that they
+// may set their own.
+func (c *Client) httpClient() *http.Client {
+	rt := c.client.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	ua := c.UserAgent
+	if ua == "" {
+		ua = DefaultUserAgent
+	}
+	rt = userAgent(ua, rt)
+	for i := len(c.Middleware) - 1; i >= 0; i-- {
+		rt = c.Middleware[i](rt)
+	}
+
+	checkRedirect := c.client.CheckRedirect
+	if c.RedirectPolicy != (RedirectPolicy{}) {
+		checkRedirect = c.RedirectPolicy.checkRedirect(checkRedirect)
+	}
+	return &http.Client{
+		Transport:     rt,
+		CheckRedirect: checkRedirect,
+		Jar:           c.client.Jar,
+		Timeout:       c.client.Timeout,
+	}
+}
@@ -0,0 +1,110 @@
+package webfinger
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var userAgents []string
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		userAgents = append(userAgents, r.UserAgent())
+		http.NotFound(w, r)
+	})
+
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name+" "+req.URL.Query().Get("resource"))
+				return next.RoundTrip(req)
+			})
+		}
+	}
+	client.Middleware = []Middleware{trace("first"), trace("second")}
+	client.WebFistServer = testHost
+
+	if _, err := client.Lookup("bob@"+testHost, nil); err == nil {
+		t.Fatal("Expected error")
+	}
+
+	// the WebFist query goes through the middleware as well
+	resource := "acct:bob@" + testHost
+	want := []string{"first " + resource, "second " + resource, "first " + resource, "second " + resource}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("Middleware called %q, want %q", order, want)
+	}
+	if want := []string{DefaultUserAgent, DefaultUserAgent}; !reflect.DeepEqual(userAgents, want) {
+		t.Errorf("Requests sent with User-Agent %q, want %q", userAgents, want)
+	}
+
+	// middleware may set its own User-Agent
+	userAgents = nil
+	client.WebFistServer = ""
+	client.Middleware = []Middleware{func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			req.Header.Set("User-Agent", "directory/1.0")
+			return next.RoundTrip(req)
+		})
+	}}
+	client.UserAgent = "app/2.0"
+	client.Lookup("bob@"+testHost, nil)
+	if want := []string{"directory/1.0"}; !reflect.DeepEqual(userAgents, want) {
+		t.Errorf("Requests sent with User-Agent %q, want %q", userAgents, want)
+	}
+
+	userAgents = nil
+	client.Middleware = nil
+	res, err := client.HTTPClient().Get("https://" + testHost + "/.well-known/webfinger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if want := []string{"app/2.0"}; !reflect.DeepEqual(userAgents, want) {
+		t.Errorf("HTTPClient sent User-Agent %q, want %q", userAgents, want)
+	}
+}
+
+func TestMiddleware_httpClientChanges(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	})
+	client.WebFistServer = ""
+	if _, err := client.Lookup("bob@"+testHost, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// changes to the http.Client passed to NewClient apply to the next lookups
+	errSwapped := errors.New("swapped transport")
+	client.client.Transport = RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, errSwapped
+	})
+	if _, err := client.Lookup("bob@"+testHost, nil); !errors.Is(err, errSwapped) {
+		t.Errorf("Lookup returned error %v, want %v", err, errSwapped)
+	}
+
+	// so do Middleware modified in place
+	called := false
+	client.Middleware = []Middleware{nil}
+	client.Middleware[0] = func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			called = true
+			return next.RoundTrip(req)
+		})
+	}
+	client.Lookup("bob@"+testHost, nil)
+	if !called {
+		t.Error("Middleware modified in place was not called")
+	}
+}
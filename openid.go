@@ -0,0 +1,134 @@
+package webfinger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/ant0ine/go-webfinger/jrd"
+)
+
+// OpenIDConfiguration is the OpenID Provider metadata published at
+// /.well-known/openid-configuration, as defined by OpenID Connect Discovery 1.0
+// section 3.
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint,omitempty"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint,omitempty"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	RegistrationEndpoint              string   `json:"registration_endpoint,omitempty"`
+	ScopesSupported                   []string `json:"scopes_supported,omitempty"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported,omitempty"`
+	ClaimsSupported                   []string `json:"claims_supported,omitempty"`
+}
+
+// DiscoverIssuer returns the OpenID Connect issuer for the specified
+// identifier, following OpenID Connect Discovery 1.0 section 2.  The
+// identifier is normalized as described in section 2.1: email-like identifiers
+// are treated as acct: URIs, and bare hosts as https URLs.
+//
+// The issuer must be an https URL with no query or fragment component.  Use
+// OpenIDConfiguration to fetch the provider metadata of the issuer.
+func (c *Client) DiscoverIssuer(ctx context.Context, identifier string) (*url.URL, error) {
+	resource, err := normalizeOpenIDIdentifier(identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := c.lookupResource(ctx, resource, []string{jrd.RelOpenIDIssuer})
+	if err != nil {
+		return nil, err
+	}
+
+	link := result.JRD.GetLinkByRel(jrd.RelOpenIDIssuer)
+	if link == nil {
+		return nil, fmt.Errorf("no OpenID Connect issuer for %s", resource)
+	}
+
+	issuer, err := url.Parse(link.Href)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateIssuer(issuer); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Found OpenID Connect issuer: %s", issuer)
+	return issuer, nil
+}
+
+// OpenIDConfiguration fetches and parses the provider metadata of issuer.  The
+// issuer in the metadata must be identical to the requested one.
+func (c *Client) OpenIDConfiguration(ctx context.Context, issuer *url.URL) (*OpenIDConfiguration, error) {
+	if err := validateIssuer(issuer); err != nil {
+		return nil, err
+	}
+
+	configURL := *issuer
+	configURL.Path = strings.TrimSuffix(issuer.Path, "/") + "/.well-known/openid-configuration"
+
+	log.Printf("GET %s", configURL.String())
+	res, err := c.get(ctx, configURL.String())
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if !(200 <= res.StatusCode && res.StatusCode < 300) {
+		return nil, errors.New(res.Status)
+	}
+
+	content, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	config := OpenIDConfiguration{}
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, err
+	}
+	if config.Issuer != issuer.String() {
+		return nil, fmt.Errorf("OpenID configuration issuer %q does not match %q", config.Issuer, issuer)
+	}
+	return &config, nil
+}
+
+// normalizeOpenIDIdentifier converts user input into a Resource, following
+// OpenID Connect Discovery 1.0 section 2.1.
+func normalizeOpenIDIdentifier(identifier string) (*Resource, error) {
+	identifier = strings.TrimSpace(identifier)
+	if identifier == "" {
+		return nil, errors.New("empty OpenID identifier")
+	}
+	if !strings.Contains(identifier, "@") && !strings.Contains(identifier, "://") {
+		identifier = "https://" + identifier
+	}
+
+	resource, err := Parse(identifier)
+	if err != nil {
+		return nil, err
+	}
+	resource.Fragment = ""
+	return resource, nil
+}
+
+// validateIssuer checks that issuer is an https URL with no query or fragment
+// component, as required by OpenID Connect Discovery 1.0 section 3.
+func validateIssuer(issuer *url.URL) error {
+	if issuer.Scheme != "https" || issuer.Host == "" {
+		return fmt.Errorf("OpenID issuer must be an https URL: %s", issuer)
+	}
+	if issuer.RawQuery != "" || issuer.ForceQuery || issuer.Fragment != "" {
+		return fmt.Errorf("OpenID issuer must not have a query or fragment: %s", issuer)
+	}
+	return nil
+}
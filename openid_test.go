@@ -0,0 +1,104 @@
+package webfinger
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/ant0ine/go-webfinger/jrd"
+)
+
+func TestDiscoverIssuer(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.FormValue("rel"), jrd.RelOpenIDIssuer; got != want {
+			t.Errorf("Requested rel: %v, want %v", got, want)
+		}
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprintf(w, `{
+			"subject": %q,
+			"links": [{"rel": %q, "href": "%s/op"}]
+		}`, r.FormValue("resource"), jrd.RelOpenIDIssuer, server.URL)
+	})
+	mux.HandleFunc("/op/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/json")
+		fmt.Fprintf(w, `{
+			"issuer": "%s/op",
+			"authorization_endpoint": "%s/op/authorize",
+			"jwks_uri": "%s/op/jwks"
+		}`, server.URL, server.URL, server.URL)
+	})
+
+	issuer, err := client.DiscoverIssuer(context.Background(), "joe@"+testHost)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got, want := issuer.String(), server.URL+"/op"; got != want {
+		t.Errorf("DiscoverIssuer returned %q, want %q", got, want)
+	}
+
+	config, err := client.OpenIDConfiguration(context.Background(), issuer)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got, want := config.AuthorizationEndpoint, server.URL+"/op/authorize"; got != want {
+		t.Errorf("AuthorizationEndpoint is %q, want %q", got, want)
+	}
+}
+
+func TestDiscoverIssuer_invalidIssuer(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprintf(w, `{"links": [{"rel": %q, "href": "%s/op?tenant=1"}]}`, jrd.RelOpenIDIssuer, server.URL)
+	})
+
+	_, err := client.DiscoverIssuer(context.Background(), "joe@"+testHost)
+	if err == nil {
+		t.Error("Expected invalid issuer error")
+	}
+}
+
+func TestOpenIDConfiguration_issuerMismatch(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/json")
+		fmt.Fprint(w, `{"issuer": "https://evil.example.com"}`)
+	})
+
+	issuer, _ := url.Parse(server.URL)
+	_, err := client.OpenIDConfiguration(context.Background(), issuer)
+	if err == nil {
+		t.Error("Expected issuer mismatch error")
+	}
+}
+
+func TestNormalizeOpenIDIdentifier(t *testing.T) {
+	tests := []struct {
+		identifier, want string
+	}{
+		{"joe@example.com", "acct:joe@example.com"},
+		{"example.com", "https://example.com"},
+		{"example.com:8080/joe", "https://example.com:8080/joe"},
+		{"https://example.com/joe#frag", "https://example.com/joe"},
+		{"acct:joe@example.com", "acct:joe@example.com"},
+	}
+	for _, tt := range tests {
+		r, err := normalizeOpenIDIdentifier(tt.identifier)
+		if err != nil {
+			t.Errorf("normalizeOpenIDIdentifier(%q) returned error: %v", tt.identifier, err)
+			continue
+		}
+		if got := r.String(); got != tt.want {
+			t.Errorf("normalizeOpenIDIdentifier(%q) returned %q, want %q", tt.identifier, got, tt.want)
+		}
+	}
+}
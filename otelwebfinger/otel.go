@@ -0,0 +1,179 @@
+// Package otelwebfinger instruments WebFinger clients with OpenTelemetry
+// traces and metrics.
+//
+// Example:
+//
+//	inst, err := otelwebfinger.New(nil, nil)
+//	if err != nil {
+//		panic(err)
+//	}
+//	client := webfinger.NewClient(nil)
+//	client.Instrumentation = inst
+package otelwebfinger
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ant0ine/go-webfinger"
+)
+
+// ScopeName is the instrumentation scope of the tracer and meter.
+const ScopeName = "github.com/ant0ine/go-webfinger"
+
+// Attribute keys set on spans and metrics.
+const (
+	HostKey        = attribute.Key("webfinger.host")
+	ResourceKey    = attribute.Key("webfinger.resource")
+	StrategyKey    = attribute.Key("webfinger.strategy")
+	OutcomeKey     = attribute.Key("webfinger.outcome")
+	StatusClassKey = attribute.Key("http.status_class")
+	ServerKey      = attribute.Key("webfinger.webfist.server")
+	URLKey         = attribute.Key("url.full")
+	StatusCodeKey  = attribute.Key("http.response.status_code")
+)
+
+// Instrumentation is a webfinger.Instrumentation recording OpenTelemetry spans
+// for lookups, HTTP requests, WebFist fallbacks and WebFist servers, and
+// metrics for lookups and HTTP requests.
+type Instrumentation struct {
+	tracer trace.Tracer
+
+	lookups        metric.Int64Counter
+	lookupDuration metric.Float64Histogram
+	fetches        metric.Int64Counter
+	fetchDuration  metric.Float64Histogram
+}
+
+var _ webfinger.Instrumentation = (*Instrumentation)(nil)
+
+// New returns an Instrumentation using the specified providers.  If nil, the
+// global providers are used.
+func New(tp trace.TracerProvider, mp metric.MeterProvider) (*Instrumentation, error) {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	if mp == nil {
+		mp = otel.GetMeterProvider()
+	}
+
+	i := &Instrumentation{tracer: tp.Tracer(ScopeName)}
+	meter := mp.Meter(ScopeName)
+
+	var err error
+	i.lookups, err = meter.Int64Counter("webfinger.client.lookups",
+		metric.WithDescription("Number of WebFinger lookups"))
+	if err != nil {
+		return nil, err
+	}
+	i.lookupDuration, err = meter.Float64Histogram("webfinger.client.lookup.duration",
+		metric.WithDescription("Duration of WebFinger lookups"),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+	i.fetches, err = meter.Int64Counter("webfinger.client.requests",
+		metric.WithDescription("Number of HTTP requests fetching JRDs"))
+	if err != nil {
+		return nil, err
+	}
+	i.fetchDuration, err = meter.Float64Histogram("webfinger.client.request.duration",
+		metric.WithDescription("Duration of HTTP requests fetching JRDs"),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// StartLookup implements webfinger.Instrumentation.
+func (i *Instrumentation) StartLookup(ctx context.Context, resource *webfinger.Resource) (context.Context, func(*webfinger.Result, error)) {
+	host := resource.WebFingerHost()
+	ctx, span := i.tracer.Start(ctx, "webfinger.Lookup", trace.WithAttributes(
+		ResourceKey.String(resource.String()),
+		HostKey.String(host),
+	))
+	start := time.Now()
+
+	return ctx, func(result *webfinger.Result, err error) {
+		attrs := []attribute.KeyValue{HostKey.String(host)}
+		if err != nil {
+			attrs = append(attrs, OutcomeKey.String("error"))
+			endSpan(span, err)
+		} else {
+			attrs = append(attrs,
+				OutcomeKey.String("ok"),
+				StrategyKey.String(string(result.Strategy)))
+			span.SetAttributes(StrategyKey.String(string(result.Strategy)))
+			endSpan(span, nil)
+		}
+
+		set := metric.WithAttributes(attrs...)
+		i.lookups.Add(ctx, 1, set)
+		i.lookupDuration.Record(ctx, time.Since(start).Seconds(), set)
+	}
+}
+
+// StartFetch implements webfinger.Instrumentation.
+func (i *Instrumentation) StartFetch(ctx context.Context, u *url.URL) (context.Context, func(webfinger.Attempt)) {
+	ctx, span := i.tracer.Start(ctx, "webfinger.Fetch", trace.WithAttributes(
+		URLKey.String(u.String()),
+		HostKey.String(u.Host),
+	), trace.WithSpanKind(trace.SpanKindClient))
+
+	return ctx, func(a webfinger.Attempt) {
+		if a.StatusCode != 0 {
+			span.SetAttributes(StatusCodeKey.Int(a.StatusCode))
+		}
+		endSpan(span, a.Err)
+
+		set := metric.WithAttributes(
+			HostKey.String(u.Host),
+			StatusClassKey.String(statusClass(a.StatusCode)))
+		i.fetches.Add(ctx, 1, set)
+		i.fetchDuration.Record(ctx, a.Duration.Seconds(), set)
+	}
+}
+
+// StartFallback implements webfinger.Instrumentation.
+func (i *Instrumentation) StartFallback(ctx context.Context, resource *webfinger.Resource, servers []string) (context.Context, func(error)) {
+	ctx, span := i.tracer.Start(ctx, "webfinger.WebFistFallback", trace.WithAttributes(
+		ResourceKey.String(resource.String()),
+		attribute.StringSlice("webfinger.webfist.servers", servers),
+	))
+	return ctx, func(err error) { endSpan(span, err) }
+}
+
+// StartWebFist implements webfinger.Instrumentation.
+func (i *Instrumentation) StartWebFist(ctx context.Context, resource *webfinger.Resource, server string) (context.Context, func(error)) {
+	ctx, span := i.tracer.Start(ctx, "webfinger.WebFist", trace.WithAttributes(
+		ResourceKey.String(resource.String()),
+		ServerKey.String(server),
+	))
+	return ctx, func(err error) { endSpan(span, err) }
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// statusClass returns the class of an HTTP status code, such as "2xx", or
+// "error" if no response was received.
+func statusClass(code int) string {
+	if code == 0 {
+		return "error"
+	}
+	return strconv.Itoa(code/100) + "xx"
+}
@@ -0,0 +1,102 @@
+package otelwebfinger
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/ant0ine/go-webfinger"
+)
+
+func TestInstrumentation(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"acct:bob@example.com"}`)
+	}))
+	defer s.Close()
+	u, _ := url.Parse(s.URL)
+
+	spans := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(spans))
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	inst, err := New(tp, mp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := webfinger.NewClient(nil)
+	c.SchemePolicy = webfinger.HTTPOnlyForHosts(u.Host)
+	c.Instrumentation = inst
+
+	if _, err := c.Lookup("bob@"+u.Host, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	stubs := spans.GetSpans()
+	if len(stubs) != 2 {
+		t.Fatalf("Recorded %d spans, want 2", len(stubs))
+	}
+	fetch, lookup := stubs[0], stubs[1]
+	if got, want := lookup.Name, "webfinger.Lookup"; got != want {
+		t.Errorf("Lookup span is named %q, want %q", got, want)
+	}
+	if got, want := fetch.Name, "webfinger.Fetch"; got != want {
+		t.Errorf("Fetch span is named %q, want %q", got, want)
+	}
+	if fetch.Parent.SpanID() != lookup.SpanContext.SpanID() {
+		t.Error("Fetch span is not a child of the lookup span")
+	}
+	if !hasAttribute(lookup.Attributes, StrategyKey.String("webfinger")) {
+		t.Errorf("Lookup span attributes %v have no strategy", lookup.Attributes)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			sum, ok := m.Data.(metricdata.Sum[int64])
+			if !ok {
+				continue
+			}
+			for _, dp := range sum.DataPoints {
+				if class, ok := dp.Attributes.Value(StatusClassKey); ok && class.AsString() != "2xx" {
+					t.Errorf("Request recorded with status class %q", class.AsString())
+				}
+				counts[m.Name] += dp.Value
+			}
+		}
+	}
+	if counts["webfinger.client.lookups"] != 1 || counts["webfinger.client.requests"] != 1 {
+		t.Errorf("Recorded counts %v, want one lookup and one request", counts)
+	}
+}
+
+func hasAttribute(attrs []attribute.KeyValue, want attribute.KeyValue) bool {
+	for _, kv := range attrs {
+		if kv == want {
+			return true
+		}
+	}
+	return false
+}
+
+func TestStatusClass(t *testing.T) {
+	for code, want := range map[int]string{0: "error", 200: "2xx", 404: "4xx", 503: "5xx"} {
+		if got := statusClass(code); got != want {
+			t.Errorf("statusClass(%d) returned %q, want %q", code, got, want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package webfinger
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// wellKnownPath is the path of WebFinger queries.
+const wellKnownPath = "/.well-known/webfinger"
+
+// A RedirectPolicy restricts the redirects followed by WebFinger queries.  The
+// zero value follows redirects as the underlying http.Client does.
+type RedirectPolicy struct {
+	// MaxRedirects caps the number of redirects followed.  Zero keeps the
+	// limit of the http.Client, and a negative value forbids redirects.
+	MaxRedirects int
+
+	// SameHost forbids redirects to another host than the one queried.
+	SameHost bool
+
+	// NoDowngrade forbids redirects from https to http.
+	NoDowngrade bool
+
+	// WellKnownOnly forbids redirecting a WebFinger query to another path
+	// than the one queried, that is /.well-known/webfinger unless the
+	// HostResolver of the Client selects another endpoint.
+	WellKnownOnly bool
+}
+
+// A RedirectError is returned when a redirect violates the RedirectPolicy of
+// the Client.
+type RedirectError struct {
+	From, To *url.URL
+	Reason   string
+}
+
+func (e *RedirectError) Error() string {
+	return fmt.Sprintf("redirect from %s to %s refused: %s", e.From, e.To, e.Reason)
+}
+
+// check returns an error if following the redirect to req violates p.  via
+// are the requests already made, oldest first.
+func (p RedirectPolicy) check(req *http.Request, via []*http.Request) error {
+	orig, from := via[0].URL, via[len(via)-1].URL
+	refuse := func(reason string) error {
+		return &RedirectError{From: from, To: req.URL, Reason: reason}
+	}
+
+	if p.MaxRedirects != 0 && len(via) > p.MaxRedirects {
+		if p.MaxRedirects < 0 {
+			return refuse("redirects are not allowed")
+		}
+		return refuse(fmt.Sprintf("more than %d redirects", p.MaxRedirects))
+	}
+	if p.SameHost && !strings.EqualFold(req.URL.Host, orig.Host) {
+		return refuse("cross-host redirect")
+	}
+	if p.NoDowngrade && from.Scheme == "https" && req.URL.Scheme != "https" {
+		return refuse("https to http downgrade")
+	}
+	// other requests made with the client, such as WebFist proofs, have no
+	// resource parameter
+	if p.WellKnownOnly && orig.Query().Get("resource") != "" && req.URL.Path != orig.Path {
+		return refuse("redirect outside of " + orig.Path)
+	}
+	return nil
+}
+
+// checkRedirect returns the CheckRedirect function of an http.Client enforcing
+// p before calling next, if not nil.
+func (p RedirectPolicy) checkRedirect(next func(*http.Request, []*http.Request) error) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if err := p.check(req, via); err != nil {
+			return err
+		}
+		if next != nil {
+			return next(req, via)
+		}
+		// same limit as the default policy of http.Client
+		if p.MaxRedirects == 0 && len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+}
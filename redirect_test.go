@@ -0,0 +1,102 @@
+package webfinger
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirectPolicy(t *testing.T) {
+	setup()
+	defer teardown()
+
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	}))
+	defer plain.Close()
+
+	var target string
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("hop") == "" {
+			http.Redirect(w, r, target, http.StatusFound)
+			return
+		}
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	})
+	mux.HandleFunc("/bob.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	})
+
+	tests := []struct {
+		policy RedirectPolicy
+		target string
+		ok     bool
+	}{
+		{RedirectPolicy{}, "/bob.json", true},
+		{RedirectPolicy{MaxRedirects: 1}, "/bob.json", true},
+		{RedirectPolicy{MaxRedirects: -1}, "/bob.json", false},
+		{RedirectPolicy{WellKnownOnly: true}, "/bob.json", false},
+		{RedirectPolicy{WellKnownOnly: true}, "/.well-known/webfinger?hop=1", true},
+		{RedirectPolicy{SameHost: true}, plain.URL + "/bob.json", false},
+		{RedirectPolicy{NoDowngrade: true}, plain.URL + "/bob.json", false},
+		{RedirectPolicy{NoDowngrade: true, SameHost: true}, "/bob.json", true},
+	}
+	for _, tt := range tests {
+		target = tt.target
+		client.RedirectPolicy = tt.policy
+		client.WebFistServer = ""
+
+		_, err := client.Lookup("bob@"+testHost, nil)
+		if tt.ok {
+			if err != nil {
+				t.Errorf("Redirect to %s with %+v returned error: %v", tt.target, tt.policy, err)
+			}
+			continue
+		}
+		var redirectErr *RedirectError
+		if !errors.As(err, &redirectErr) {
+			t.Errorf("Redirect to %s with %+v returned error %v, want a *RedirectError", tt.target, tt.policy, err)
+		}
+	}
+}
+
+func TestRedirectPolicy_endpoint(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var target string
+	mux.HandleFunc("/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("hop") == "" {
+			http.Redirect(w, r, target, http.StatusFound)
+			return
+		}
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	})
+	mux.HandleFunc("/bob.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	})
+
+	// WellKnownOnly keeps queries on the endpoint selected by the HostResolver
+	client.HostResolver = StaticHosts{"example.com": "https://" + testHost + "/webfinger"}
+	client.RedirectPolicy = RedirectPolicy{WellKnownOnly: true}
+	client.WebFistServer = ""
+
+	target = "/webfinger?hop=1"
+	if _, err := client.Lookup("bob@example.com", nil); err != nil {
+		t.Errorf("Redirect to %s returned error: %v", target, err)
+	}
+
+	target = "/bob.json"
+	_, err := client.Lookup("bob@example.com", nil)
+	var redirectErr *RedirectError
+	if !errors.As(err, &redirectErr) {
+		t.Errorf("Redirect to %s returned error %v, want a *RedirectError", target, err)
+	}
+}
@@ -0,0 +1,203 @@
+// Package replay records the HTTP exchanges of WebFinger clients to fixture
+// files, and replays them, to run deterministic tests and demos without
+// network.
+//
+// Recording:
+//
+//	recorder := &replay.Recorder{}
+//	client := webfinger.NewClient(nil)
+//	client.Middleware = append(client.Middleware, recorder.Middleware)
+//	client.Lookup("bob@example.com", nil)
+//	recorder.Save("testdata/bob.json")
+//
+// Replaying:
+//
+//	client, err := replay.NewClient("testdata/bob.json")
+//	if err != nil {
+//		panic(err)
+//	}
+//	client.Lookup("bob@example.com", nil)
+//
+// Fixtures do not hold credentials: cookies and authorization headers are not
+// recorded, nor are the user information of URLs.
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/ant0ine/go-webfinger"
+)
+
+// sensitiveHeaders are the headers not recorded.
+var sensitiveHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Set-Cookie",
+	"Set-Cookie2",
+	"Www-Authenticate",
+}
+
+// A Fixture is a recorded HTTP exchange.
+type Fixture struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+
+	// Body is the response body, base64 encoded in fixture files so that
+	// it is kept byte for byte.
+	Body []byte `json:"body,omitempty"`
+}
+
+// Recorder records the HTTP exchanges going through its Middleware.
+type Recorder struct {
+	mu       sync.Mutex
+	fixtures []Fixture
+}
+
+// Middleware is a webfinger.Middleware recording the exchanges of next.
+func (r *Recorder) Middleware(next http.RoundTripper) http.RoundTripper {
+	return webfinger.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		res, err := next.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		res.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		header := res.Header.Clone()
+		for _, name := range sensitiveHeaders {
+			header.Del(name)
+		}
+
+		r.mu.Lock()
+		r.fixtures = append(r.fixtures, Fixture{
+			Method: req.Method,
+			URL:    fixtureURL(req.URL),
+			Status: res.StatusCode,
+			Header: header,
+			Body:   body,
+		})
+		r.mu.Unlock()
+		return res, nil
+	})
+}
+
+// fixtureURL returns the URL of fixtures for requests of u, without user
+// information.
+func fixtureURL(u *url.URL) string {
+	c := *u
+	c.User = nil
+	return c.String()
+}
+
+// Fixtures returns the exchanges recorded so far.
+func (r *Recorder) Fixtures() []Fixture {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Fixture(nil), r.fixtures...)
+}
+
+// Save writes the exchanges recorded so far to the fixtures file path.
+func (r *Recorder) Save(path string) error {
+	content, err := json.MarshalIndent(r.Fixtures(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(content, '\n'), 0644)
+}
+
+// Load reads the fixtures file path.
+func Load(path string) ([]Fixture, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var fixtures []Fixture
+	if err := json.Unmarshal(content, &fixtures); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return fixtures, nil
+}
+
+// A MissingFixtureError is returned by a Transport for requests it has no
+// fixture for.
+type MissingFixtureError struct {
+	Method, URL string
+}
+
+func (e *MissingFixtureError) Error() string {
+	return fmt.Sprintf("replay: no fixture for %s %s", e.Method, e.URL)
+}
+
+// Transport is an http.RoundTripper serving recorded exchanges.  Requests are
+// answered with the first fixture of the same method and URL.
+type Transport struct {
+	Fixtures []Fixture
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	u := fixtureURL(req.URL)
+	for _, f := range t.Fixtures {
+		if f.Method != req.Method || f.URL != u {
+			continue
+		}
+		header := f.Header.Clone()
+		if header == nil {
+			header = http.Header{}
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", f.Status, http.StatusText(f.Status)),
+			StatusCode:    f.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          ioutil.NopCloser(bytes.NewReader(f.Body)),
+			ContentLength: int64(len(f.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, &MissingFixtureError{req.Method, u}
+}
+
+// errNoDNS is returned by the DNS lookups of replaying clients.
+var errNoDNS = errors.New("replay: no DNS lookups when replaying")
+
+// offlineResolver is a dkim.TXTResolver failing all lookups.
+type offlineResolver struct{}
+
+func (offlineResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	return nil, errNoDNS
+}
+
+// NewClient returns a webfinger.Client replaying the fixtures file path,
+// without network access.  The WebFist fallback is disabled, as the DKIM
+// lookups verifying delegations are not recorded; if enabled again, they
+// fail.
+func NewClient(path string) (*webfinger.Client, error) {
+	fixtures, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	client := webfinger.NewClient(&http.Client{Transport: &Transport{Fixtures: fixtures}})
+	client.DisableWebFist = true
+	client.DKIMResolver = offlineResolver{}
+	return client, nil
+}
@@ -0,0 +1,92 @@
+package replay
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ant0ine/go-webfinger"
+)
+
+func TestRecordReplay(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/bob.json", http.StatusFound)
+	})
+	mux.HandleFunc("/bob.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		w.Header().Add("set-cookie", "session=secret")
+		// not valid UTF-8, which fixtures keep as is
+		fmt.Fprint(w, `{"subject":"acct:bob@example.com","properties":{"p":"`+"\xff"+`"}}`)
+	})
+	s := httptest.NewTLSServer(mux)
+	u, _ := url.Parse(s.URL)
+	identifier := "bob@" + u.Host
+
+	recorder := &Recorder{}
+	client := webfinger.NewClient(&http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	})
+	client.Middleware = []webfinger.Middleware{recorder.Middleware}
+	if _, err := client.Lookup(identifier, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	s.Close()
+
+	if got := len(recorder.Fixtures()); got != 2 {
+		t.Fatalf("Recorded %d exchanges, want 2", got)
+	}
+
+	dir, err := ioutil.TempDir("", "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bob.json")
+	if err := recorder.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := ioutil.ReadFile(path); strings.Contains(string(content), "secret") {
+		t.Errorf("Fixtures file holds the cookie: %s", content)
+	}
+	fixtures, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fixtures[1].Body, recorder.Fixtures()[1].Body; !bytes.Equal(got, want) || !bytes.Contains(got, []byte{0xff}) {
+		t.Errorf("Loaded body %q, want %q", got, want)
+	}
+
+	// the server is closed, lookups are served from the fixtures
+	client, err = NewClient(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := client.LookupWithInfo(identifier, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got, want := result.JRD.Subject, "acct:bob@example.com"; got != want {
+		t.Errorf("Subject is %q, want %q", got, want)
+	}
+	if got, want := result.FinalURL.Path, "/bob.json"; got != want {
+		t.Errorf("FinalURL path is %q, want %q", got, want)
+	}
+
+	_, err = client.Lookup("alice@"+u.Host, nil)
+	var missing *MissingFixtureError
+	if !errors.As(err, &missing) {
+		t.Errorf("Lookup returned error %v, want a *MissingFixtureError", err)
+	}
+}
@@ -0,0 +1,105 @@
+package webfinger
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/ant0ine/go-webfinger/jrd"
+)
+
+// A VerificationError is returned by ResolveVerified when a handle does not
+// round-trip between its WebFinger host and the host of its actor.
+type VerificationError struct {
+	// Resource is the resource being verified when the failure occurred.
+	Resource string
+
+	// Reason describes why verification failed.
+	Reason string
+
+	// Err is the underlying lookup error, if any.
+	Err error
+}
+
+func (e *VerificationError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("webfinger: cannot verify %s: %s: %v", e.Resource, e.Reason, e.Err)
+	}
+	return fmt.Sprintf("webfinger: cannot verify %s: %s", e.Resource, e.Reason)
+}
+
+// Unwrap returns the underlying lookup error, if any.
+func (e *VerificationError) Unwrap() error {
+	return e.Err
+}
+
+// ResolveVerified resolves a fediverse handle such as "alice@example.com" and
+// verifies that it round-trips.  The handle's self link is followed to the
+// actor, and the actor's host is queried for the actor URL.  The acct URI it
+// reports as subject is the canonical handle, which must itself point back to
+// the same actor.
+//
+// The canonical acct URI is returned.  If verification fails, the returned
+// error is a *VerificationError.
+func (c *Client) ResolveVerified(identifier string) (string, error) {
+	resource, err := Parse(identifier)
+	if err != nil {
+		return "", err
+	}
+
+	actor, err := c.resolveActor(resource)
+	if err != nil {
+		return "", err
+	}
+
+	// reverse lookup, on the host of the actor
+	log.Printf("Verifying %s against %s", resource, actor)
+	actorResource := Resource(*actor)
+	reverse, err := c.LookupResource(&actorResource, []string{jrd.RelSelf})
+	if err != nil {
+		return "", &VerificationError{actor.String(), "reverse lookup failed", err}
+	}
+
+	canonical, err := Parse(reverse.Subject)
+	if err != nil || canonical.Scheme != "acct" {
+		return "", &VerificationError{actor.String(), fmt.Sprintf("subject %q is not an acct URI", reverse.Subject), nil}
+	}
+
+	// the handle we started from is not the canonical one, make sure the
+	// canonical one points to the same actor.
+	if !strings.EqualFold(canonical.String(), resource.String()) {
+		canonicalActor, err := c.resolveActor(canonical)
+		if err != nil {
+			return "", err
+		}
+		if canonicalActor.String() != actor.String() {
+			return "", &VerificationError{canonical.String(), fmt.Sprintf("self link %s does not match actor %s", canonicalActor, actor), nil}
+		}
+	}
+
+	return canonical.String(), nil
+}
+
+// resolveActor looks up resource and returns the URL of its self link.
+func (c *Client) resolveActor(resource *Resource) (*url.URL, error) {
+	resourceJRD, err := c.LookupResource(resource, []string{jrd.RelSelf})
+	if err != nil {
+		return nil, &VerificationError{resource.String(), "lookup failed", err}
+	}
+
+	link := resourceJRD.ActorLink(true)
+	if link == nil {
+		return nil, &VerificationError{resource.String(), "no self link", nil}
+	}
+
+	actor, err := url.Parse(link.Href)
+	if err != nil {
+		return nil, &VerificationError{resource.String(), "invalid self link", err}
+	}
+	if !actor.IsAbs() || actor.Host == "" {
+		return nil, &VerificationError{resource.String(), fmt.Sprintf("self link %q is not an absolute URL", link.Href), nil}
+	}
+
+	return actor, nil
+}
@@ -0,0 +1,126 @@
+package webfinger
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// handleActors serves WebFinger responses for the acct URIs in handles, each
+// mapped to the path of its actor.  Reverse lookups of an actor URL return
+// subject, which is the acct URI to report as canonical.
+func handleActors(handles map[string]string, subject string) {
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		resource := r.FormValue("resource")
+		w.Header().Add("content-type", "application/jrd+json")
+
+		if path, ok := handles[resource]; ok {
+			fmt.Fprintf(w, `{
+				"subject": %q,
+				"links": [{
+					"rel": "self",
+					"type": "application/activity+json",
+					"href": "%s%s"
+				}]
+			}`, resource, server.URL, path)
+			return
+		}
+		if resource == server.URL+"/users/bob" {
+			fmt.Fprintf(w, `{"subject": %q}`, subject)
+			return
+		}
+		http.NotFound(w, r)
+	})
+}
+
+func TestResolveVerified(t *testing.T) {
+	setup()
+	defer teardown()
+
+	handleActors(map[string]string{
+		"acct:bob@" + testHost: "/users/bob",
+	}, "acct:bob@"+testHost)
+
+	got, err := client.ResolveVerified("bob@" + testHost)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := "acct:bob@" + testHost; got != want {
+		t.Errorf("ResolveVerified returned %q, want %q", got, want)
+	}
+}
+
+func TestResolveVerified_alias(t *testing.T) {
+	setup()
+	defer teardown()
+
+	handleActors(map[string]string{
+		"acct:robert@" + testHost: "/users/bob",
+		"acct:bob@" + testHost:    "/users/bob",
+	}, "acct:bob@"+testHost)
+
+	got, err := client.ResolveVerified("robert@" + testHost)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := "acct:bob@" + testHost; got != want {
+		t.Errorf("ResolveVerified returned %q, want %q", got, want)
+	}
+}
+
+func TestResolveVerified_mismatch(t *testing.T) {
+	setup()
+	defer teardown()
+
+	handleActors(map[string]string{
+		"acct:mallory@" + testHost: "/users/bob",
+		"acct:bob@" + testHost:     "/users/bobby",
+	}, "acct:bob@"+testHost)
+
+	_, err := client.ResolveVerified("mallory@" + testHost)
+	var verr *VerificationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("ResolveVerified returned error %#v, want *VerificationError", err)
+	}
+	if want := "acct:bob@" + testHost; verr.Resource != want {
+		t.Errorf("VerificationError.Resource is %q, want %q", verr.Resource, want)
+	}
+}
+
+func TestResolveVerified_noSelfLink(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"acct:bob@example.com"}`)
+	})
+
+	_, err := client.ResolveVerified("bob@" + testHost)
+	var verr *VerificationError
+	if !errors.As(err, &verr) {
+		t.Errorf("ResolveVerified returned error %#v, want *VerificationError", err)
+	}
+}
+
+func TestResolveVerified_untypedSelfLink(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprintf(w, `{
+			"subject": "acct:bob@%s",
+			"links": [{"rel": "self", "href": "%s/users/bob"}]
+		}`, testHost, server.URL)
+	})
+
+	got, err := client.ResolveVerified("acct:bob@" + testHost)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := "acct:bob@" + testHost; got != want {
+		t.Errorf("ResolveVerified returned %q, want %q", got, want)
+	}
+}
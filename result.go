@@ -0,0 +1,147 @@
+package webfinger
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/ant0ine/go-webfinger/jrd"
+)
+
+// A Strategy is the way a JRD was obtained.
+type Strategy string
+
+const (
+	// StrategyWebFinger means the JRD was served by the host of the resource.
+	StrategyWebFinger Strategy = "webfinger"
+
+	// StrategyWebFist means the JRD was delegated through a WebFist server.
+	StrategyWebFist Strategy = "webfist"
+)
+
+// A CacheStatus tells whether a JRD was served from a cache.
+type CacheStatus string
+
+const (
+	// CacheMiss means the JRD was fetched from the network.
+	CacheMiss CacheStatus = "miss"
+
+	// CacheHit means the JRD was served from the cache of the Client.
+	CacheHit CacheStatus = "hit"
+
+	// CacheStale means the JRD was served from the cache after it expired,
+	// while it is refreshed in the background.
+	CacheStale CacheStatus = "stale"
+
+	// CacheStaleIfError means the JRD was served from the cache after it
+	// expired, because refreshing it failed.
+	CacheStaleIfError CacheStatus = "stale-if-error"
+)
+
+// An Attempt is a single HTTP request issued during a lookup.
+type Attempt struct {
+	URL        *url.URL
+	StatusCode int // zero if no response was received
+	Err        error
+	Duration   time.Duration
+}
+
+// A Result is the outcome of a successful lookup.
+type Result struct {
+	JRD *jrd.JRD
+
+	// QueryURL is the URL the JRD was requested at, with the scheme used.
+	QueryURL *url.URL
+
+	// FinalURL is the URL that served the JRD, after redirects.
+	FinalURL *url.URL
+
+	// Redirects are the URLs redirected to from QueryURL, in order, the last
+	// one being FinalURL.  It is empty if there was no redirect.
+	Redirects []*url.URL
+
+	// Scheme is the scheme of QueryURL, which differs from "https" if the
+	// query was downgraded by the SchemePolicy of the Client.
+	Scheme string
+
+	Strategy Strategy
+
+	// WebFistServer is the WebFist server that delegated the JRD, if
+	// Strategy is StrategyWebFist.
+	WebFistServer string
+
+	// StatusCode and Header are those of the response that served the JRD.
+	StatusCode int
+	Header     http.Header
+
+	CacheStatus CacheStatus
+
+	// Attempts are all the HTTP requests issued for the JRD, including failed
+	// ones, in the order they completed.
+	Attempts []Attempt
+
+	// Duration is the total time spent on the lookup.
+	Duration time.Duration
+}
+
+// LookupWithInfo returns the JRD for the specified identifier, along with
+// information on how it was obtained.
+func (c *Client) LookupWithInfo(identifier string, rels []string) (*Result, error) {
+	resource, err := Parse(identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.lookupResource(context.Background(), resource, rels)
+}
+
+func newResult(fetched *fetchResult, strategy Strategy, rec *recorder, d time.Duration) *Result {
+	return &Result{
+		JRD:           fetched.JRD,
+		QueryURL:      fetched.URL,
+		FinalURL:      fetched.FinalURL,
+		Redirects:     fetched.Redirects,
+		Scheme:        fetched.URL.Scheme,
+		Strategy:      strategy,
+		WebFistServer: fetched.WebFistServer,
+		StatusCode:    fetched.StatusCode,
+		Header:        fetched.Header,
+		CacheStatus:   CacheMiss,
+		Attempts:      rec.attempts(),
+		Duration:      d,
+	}
+}
+
+// recorder collects the attempts of a lookup, possibly from concurrent WebFist
+// queries.
+type recorder struct {
+	mu   sync.Mutex
+	list []Attempt
+}
+
+func (r *recorder) add(a Attempt) {
+	r.mu.Lock()
+	r.list = append(r.list, a)
+	r.mu.Unlock()
+}
+
+func (r *recorder) attempts() []Attempt {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Attempt(nil), r.list...)
+}
+
+type recorderKey struct{}
+
+func withRecorder(ctx context.Context, r *recorder) context.Context {
+	return context.WithValue(ctx, recorderKey{}, r)
+}
+
+// recordAttempt adds a to the recorder of ctx, if any.
+func recordAttempt(ctx context.Context, a Attempt) {
+	if r, ok := ctx.Value(recorderKey{}).(*recorder); ok {
+		r.add(a)
+	}
+}
@@ -0,0 +1,91 @@
+package webfinger
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestLookupWithInfo(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/bob.json", http.StatusFound)
+	})
+	mux.HandleFunc("/bob.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		w.Header().Add("cache-control", "max-age=60")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	})
+
+	result, err := client.LookupWithInfo("bob@"+testHost, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got, want := result.JRD.Subject, "bob@example.com"; got != want {
+		t.Errorf("JRD subject is %q, want %q", got, want)
+	}
+	if got, want := result.QueryURL.Path, "/.well-known/webfinger"; got != want {
+		t.Errorf("QueryURL path is %q, want %q", got, want)
+	}
+	if got, want := result.FinalURL.String(), "https://"+testHost+"/bob.json"; got != want {
+		t.Errorf("FinalURL is %q, want %q", got, want)
+	}
+	if len(result.Redirects) != 1 || result.Redirects[0].String() != result.FinalURL.String() {
+		t.Errorf("Redirects are %v, want [%v]", result.Redirects, result.FinalURL)
+	}
+	if got, want := result.Scheme, "https"; got != want {
+		t.Errorf("Scheme is %q, want %q", got, want)
+	}
+	if got, want := result.Strategy, StrategyWebFinger; got != want {
+		t.Errorf("Strategy is %q, want %q", got, want)
+	}
+	if got, want := result.StatusCode, http.StatusOK; got != want {
+		t.Errorf("StatusCode is %d, want %d", got, want)
+	}
+	if got, want := result.Header.Get("cache-control"), "max-age=60"; got != want {
+		t.Errorf("Cache-Control header is %q, want %q", got, want)
+	}
+	if got, want := result.CacheStatus, CacheMiss; got != want {
+		t.Errorf("CacheStatus is %q, want %q", got, want)
+	}
+	if len(result.Attempts) != 1 || result.Attempts[0].Err != nil {
+		t.Errorf("Attempts are %+v, want a single successful one", result.Attempts)
+	}
+	if result.Duration <= 0 {
+		t.Errorf("Duration is %v, want > 0", result.Duration)
+	}
+}
+
+func TestLookupWithInfo_attempts(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+
+	client.WebFistServer = ""
+	if _, err := client.LookupWithInfo("bob@"+testHost, nil); err == nil {
+		t.Error("Expected error")
+	}
+
+	rec := &recorder{}
+	ctx := withRecorder(context.Background(), rec)
+	r, _ := Parse("bob@" + testHost)
+	if _, err := client.fetchJRD(ctx, r.JRDURL("", nil), r.WebFingerHost(), false); err == nil {
+		t.Error("Expected error")
+	}
+	attempts := rec.attempts()
+	if len(attempts) != 1 {
+		t.Fatalf("Recorded %d attempts, want 1", len(attempts))
+	}
+	if got, want := attempts[0].StatusCode, http.StatusNotFound; got != want {
+		t.Errorf("Attempt status is %d, want %d", got, want)
+	}
+	if attempts[0].Err == nil {
+		t.Error("Attempt has no error")
+	}
+}
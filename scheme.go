@@ -0,0 +1,109 @@
+package webfinger
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// A SchemePolicy decides which URL schemes are used to issue WebFinger queries
+// to a host.
+type SchemePolicy interface {
+	// Schemes returns the schemes to use for host, in order.  The next scheme
+	// is only tried if the previous one failed to connect, or to establish a
+	// trusted TLS connection.
+	Schemes(host string) []string
+}
+
+type schemes []string
+
+func (s schemes) Schemes(host string) []string {
+	return s
+}
+
+var (
+	// HTTPSOnly issues all queries over HTTPS, as required by the WebFinger
+	// spec.
+	HTTPSOnly SchemePolicy = schemes{"https"}
+
+	// HTTPSThenHTTP issues queries over HTTPS, and retries them over plain
+	// HTTP if the host does not accept HTTPS connections.  It should only
+	// ever be used for development.
+	HTTPSThenHTTP SchemePolicy = schemes{"https", "http"}
+)
+
+type httpOnlyForHosts map[string]bool
+
+func (h httpOnlyForHosts) Schemes(host string) []string {
+	if h[strings.ToLower(host)] {
+		return []string{"http"}
+	}
+	return HTTPSOnly.Schemes(host)
+}
+
+// HTTPOnlyForHosts returns a SchemePolicy issuing queries to the specified
+// hosts over plain HTTP, and to all other hosts over HTTPS.  Hosts must include
+// the port, if not the default one.
+func HTTPOnlyForHosts(hosts ...string) SchemePolicy {
+	h := httpOnlyForHosts{}
+	for _, host := range hosts {
+		h[strings.ToLower(host)] = true
+	}
+	return h
+}
+
+// schemePolicy returns the SchemePolicy of c.  If none is set, AllowHTTP
+// selects HTTPSThenHTTP, and HTTPSOnly is used otherwise.
+func (c *Client) schemePolicy() SchemePolicy {
+	if c.SchemePolicy != nil {
+		return c.SchemePolicy
+	}
+	if c.AllowHTTP {
+		return HTTPSThenHTTP
+	}
+	return HTTPSOnly
+}
+
+// allowsScheme reports whether the SchemePolicy of c allows fetching u, that is
+// whether the scheme of u is one of those allowed for its host.
+func (c *Client) allowsScheme(u *url.URL) bool {
+	for _, scheme := range c.schemePolicy().Schemes(u.Host) {
+		if strings.EqualFold(u.Scheme, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// isConnectError reports whether err means that a secure connection could not
+// be established with the host, in which case another scheme may be tried.
+func isConnectError(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		// the host cannot be reached whatever the scheme
+		return false
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		certInvalid      x509.CertificateInvalidError
+		hostname         x509.HostnameError
+		verification     *tls.CertificateVerificationError
+		recordHeader     tls.RecordHeaderError
+	)
+	return errors.As(err, &unknownAuthority) ||
+		errors.As(err, &certInvalid) ||
+		errors.As(err, &hostname) ||
+		errors.As(err, &verification) ||
+		errors.As(err, &recordHeader) ||
+		errors.Is(err, http.ErrSchemeMismatch)
+}
@@ -0,0 +1,102 @@
+package webfinger
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestSchemePolicy(t *testing.T) {
+	tests := []struct {
+		policy SchemePolicy
+		host   string
+		want   []string
+	}{
+		{HTTPSOnly, "example.com", []string{"https"}},
+		{HTTPSThenHTTP, "example.com", []string{"https", "http"}},
+		{HTTPOnlyForHosts("localhost:8080"), "LocalHost:8080", []string{"http"}},
+		{HTTPOnlyForHosts("localhost:8080"), "localhost", []string{"https"}},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.Schemes(tt.host); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Schemes(%q) returned %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestFetchJRD_downgrade(t *testing.T) {
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	}))
+	defer plain.Close()
+	u, _ := url.Parse(plain.URL)
+	r, _ := Parse("bob@" + u.Host)
+	jrdURL := r.JRDURL("", nil)
+
+	c := NewClient(nil)
+	if _, err := c.fetchJRD(context.Background(), jrdURL, jrdURL.Host, false); err == nil {
+		t.Error("Expected error fetching over HTTPS only")
+	}
+
+	c.SchemePolicy = HTTPSThenHTTP
+	result, err := c.fetchJRD(context.Background(), jrdURL, jrdURL.Host, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got, want := result.URL.Scheme, "http"; got != want {
+		t.Errorf("JRD fetched over %q, want %q", got, want)
+	}
+	if got, want := jrdURL.Scheme, "https"; got != want {
+		t.Errorf("fetchJRD modified the query URL scheme to %q, want %q", got, want)
+	}
+}
+
+func TestFetchJRD_noDowngradeOnHTTPError(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var schemes []string
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		schemes = append(schemes, "https")
+		http.NotFound(w, r)
+	})
+
+	client.SchemePolicy = HTTPSThenHTTP
+	r, _ := Parse("bob@" + testHost)
+	if _, err := client.fetchJRD(context.Background(), r.JRDURL("", nil), r.WebFingerHost(), false); err == nil {
+		t.Error("Expected error")
+	}
+	if want := []string{"https"}; !reflect.DeepEqual(schemes, want) {
+		t.Errorf("Queried over %v, want %v", schemes, want)
+	}
+}
+
+func TestIsConnectError(t *testing.T) {
+	// a port nobody listens on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	_, err = http.Get("https://" + addr + "/")
+	if !isConnectError(err) {
+		t.Errorf("isConnectError(%v) returned false, want true", err)
+	}
+
+	err = &url.Error{Op: "Get", URL: "https://example.invalid/", Err: &net.OpError{
+		Op:  "dial",
+		Net: "tcp",
+		Err: &net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true},
+	}}
+	if isConnectError(err) {
+		t.Errorf("isConnectError(%v) returned true for a DNS error, want false", err)
+	}
+}
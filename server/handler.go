@@ -0,0 +1,131 @@
+// Package server provides an http.Handler answering WebFinger queries.
+//
+// Following this spec: http://tools.ietf.org/html/rfc7033#section-4
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ant0ine/go-webfinger/jrd"
+)
+
+// Path is the path WebFinger queries are issued at.
+const Path = "/.well-known/webfinger"
+
+// ContentType is the media type of the responses.
+const ContentType = "application/jrd+json"
+
+// ErrNotFound is returned by a Resolver for unknown resources.
+var ErrNotFound = errors.New("webfinger: resource not found")
+
+// A Resolver returns the JRD describing a resource.
+type Resolver interface {
+	// Resolve returns the JRD of resource, or ErrNotFound if the resource is
+	// unknown.  r is the WebFinger query being answered.
+	Resolve(r *http.Request, resource string) (*jrd.JRD, error)
+}
+
+// ResolverFunc is an adapter to allow the use of ordinary functions as a
+// Resolver.
+type ResolverFunc func(r *http.Request, resource string) (*jrd.JRD, error)
+
+// Resolve calls f(r, resource).
+func (f ResolverFunc) Resolve(r *http.Request, resource string) (*jrd.JRD, error) {
+	return f(r, resource)
+}
+
+// Handler answers WebFinger queries with the JRDs provided by its Resolver.
+// It should be registered at Path.
+type Handler struct {
+	Resolver Resolver
+
+	// Metrics records the queries answered, if not nil.
+	Metrics Metrics
+}
+
+// NewHandler returns a new Handler using resolver.
+func NewHandler(resolver Resolver) *Handler {
+	return &Handler{Resolver: resolver}
+}
+
+// ServeHTTP answers the WebFinger query r.  Links are filtered by the rel
+// parameters of the query, if any.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	status := h.serve(w, r)
+
+	if h.Metrics != nil {
+		query := r.URL.Query()
+		h.Metrics.ObserveQuery(Query{
+			Status:   status,
+			Scheme:   ResourceScheme(query.Get("resource")),
+			Rels:     len(query["rel"]),
+			Duration: time.Since(start),
+		})
+	}
+}
+
+// serve answers the WebFinger query r, and returns the status of the response.
+func (h *Handler) serve(w http.ResponseWriter, r *http.Request) int {
+	// WebFinger resources are public, and meant to be queried from browsers
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return http.StatusMethodNotAllowed
+	}
+
+	query := r.URL.Query()
+	resource := query.Get("resource")
+	if resource == "" {
+		http.Error(w, "missing resource parameter", http.StatusBadRequest)
+		return http.StatusBadRequest
+	}
+
+	resourceJRD, err := h.Resolver.Resolve(r, resource)
+	if errors.Is(err, ErrNotFound) {
+		http.NotFound(w, r)
+		return http.StatusNotFound
+	}
+	if err != nil {
+		log.Printf("Cannot resolve %s: %v", resource, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return http.StatusInternalServerError
+	}
+
+	body, err := json.Marshal(FilterRels(resourceJRD, query["rel"]))
+	if err != nil {
+		log.Printf("Cannot encode JRD of %s: %v", resource, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return http.StatusInternalServerError
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Write(body)
+	return http.StatusOK
+}
+
+// FilterRels returns a copy of j keeping only the links whose rel is in rels.
+// If rels is empty, j is returned unchanged.
+func FilterRels(j *jrd.JRD, rels []string) *jrd.JRD {
+	if len(rels) == 0 {
+		return j
+	}
+
+	filtered := *j
+	filtered.Links = nil
+	for _, link := range j.Links {
+		for _, rel := range rels {
+			if link.Rel == rel {
+				filtered.Links = append(filtered.Links, link)
+				break
+			}
+		}
+	}
+	return &filtered
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/ant0ine/go-webfinger/jrd"
+)
+
+var bob = &jrd.JRD{
+	Subject: "acct:bob@example.com",
+	Links: []jrd.Link{
+		{Rel: jrd.RelProfilePage, Href: "https://example.com/@bob"},
+		{Rel: jrd.RelAvatar, Href: "https://example.com/bob.png"},
+	},
+}
+
+func testHandler() *Handler {
+	return NewHandler(ResolverFunc(func(r *http.Request, resource string) (*jrd.JRD, error) {
+		switch resource {
+		case "acct:bob@example.com":
+			return bob, nil
+		case "acct:broken@example.com":
+			return nil, errors.New("database is down")
+		}
+		return nil, ErrNotFound
+	}))
+}
+
+func TestHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", Path+"?resource=acct%3Abob%40example.com", nil)
+	testHandler().ServeHTTP(w, r)
+
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Fatalf("Status is %d, want %d", got, want)
+	}
+	if got, want := w.Header().Get("Content-Type"), ContentType; got != want {
+		t.Errorf("Content-Type is %q, want %q", got, want)
+	}
+	if got, want := w.Header().Get("Access-Control-Allow-Origin"), "*"; got != want {
+		t.Errorf("Access-Control-Allow-Origin is %q, want %q", got, want)
+	}
+	got, err := jrd.ParseJRD(w.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, bob) {
+		t.Errorf("Handler returned %#v, want %#v", got, bob)
+	}
+}
+
+func TestHandler_rel(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", Path+"?resource=acct%3Abob%40example.com&rel="+jrd.RelAvatar, nil)
+	testHandler().ServeHTTP(w, r)
+
+	got := jrd.JRD{}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Links) != 1 || got.Links[0].Rel != jrd.RelAvatar {
+		t.Errorf("Handler returned links %#v, want only the avatar", got.Links)
+	}
+	if len(bob.Links) != 2 {
+		t.Error("Handler modified the resolved JRD")
+	}
+}
+
+func TestHandler_errors(t *testing.T) {
+	tests := []struct {
+		method, target string
+		want           int
+	}{
+		{"GET", Path, http.StatusBadRequest},
+		{"GET", Path + "?resource=acct%3Aalice%40example.com", http.StatusNotFound},
+		{"GET", Path + "?resource=acct%3Abroken%40example.com", http.StatusInternalServerError},
+		{"POST", Path + "?resource=acct%3Abob%40example.com", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		testHandler().ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, nil))
+		if w.Code != tt.want {
+			t.Errorf("%s %s returned status %d, want %d", tt.method, tt.target, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"strings"
+	"time"
+)
+
+// Metrics records the queries answered by a Handler, for example to export
+// them to a monitoring system.
+type Metrics interface {
+	// ObserveQuery is called once for each query, after it is answered.
+	ObserveQuery(q Query)
+}
+
+// MetricsFunc is an adapter to allow the use of ordinary functions as
+// Metrics.
+type MetricsFunc func(q Query)
+
+// ObserveQuery calls f(q).
+func (f MetricsFunc) ObserveQuery(q Query) {
+	f(q)
+}
+
+// Query describes a query answered by a Handler.
+type Query struct {
+	// Status is the status of the response.
+	Status int
+
+	// Scheme is the scheme of the resource queried, as returned by
+	// ResourceScheme.
+	Scheme string
+
+	// Rels is the number of rel parameters filtering the links.
+	Rels int
+
+	// Duration is the time spent answering the query.
+	Duration time.Duration
+}
+
+// ResourceScheme returns the scheme of resource, to label metrics: one of
+// "acct", "mailto", "http", "https", "other" for any other scheme, or "none"
+// for resources without a scheme.  The set is closed so that arbitrary
+// queries cannot blow up the number of series.
+func ResourceScheme(resource string) string {
+	i := strings.Index(resource, ":")
+	if i <= 0 {
+		return "none"
+	}
+	switch scheme := strings.ToLower(resource[:i]); scheme {
+	case "acct", "mailto", "http", "https":
+		return scheme
+	}
+	return "other"
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler_metrics(t *testing.T) {
+	var queries []Query
+	h := testHandler()
+	h.Metrics = MetricsFunc(func(q Query) {
+		queries = append(queries, q)
+	})
+
+	for _, target := range []string{
+		Path + "?resource=acct%3Abob%40example.com&rel=avatar&rel=self",
+		Path + "?resource=https%3A%2F%2Fexample.com%2F",
+		Path,
+	} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", target, nil))
+	}
+
+	want := []Query{
+		{Status: http.StatusOK, Scheme: "acct", Rels: 2},
+		{Status: http.StatusNotFound, Scheme: "https"},
+		{Status: http.StatusBadRequest, Scheme: "none"},
+	}
+	if len(queries) != len(want) {
+		t.Fatalf("Observed %d queries, want %d", len(queries), len(want))
+	}
+	for i, q := range queries {
+		q.Duration = 0
+		if q != want[i] {
+			t.Errorf("Observed query %+v, want %+v", q, want[i])
+		}
+	}
+}
+
+func TestResourceScheme(t *testing.T) {
+	for resource, want := range map[string]string{
+		"acct:bob@example.com":   "acct",
+		"MailTo:bob@example.com": "mailto",
+		"xmpp:bob@example.com":   "other",
+		"bob@example.com":        "none",
+		"":                       "none",
+	} {
+		if got := ResourceScheme(resource); got != want {
+			t.Errorf("ResourceScheme(%q) returned %q, want %q", resource, got, want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Package promwebfinger exports the metrics of WebFinger server handlers to
+// Prometheus.
+//
+// Example:
+//
+//	metrics, err := promwebfinger.New(nil)
+//	if err != nil {
+//		panic(err)
+//	}
+//	handler := server.NewHandler(resolver)
+//	handler.Metrics = metrics
+package promwebfinger
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/ant0ine/go-webfinger/server"
+)
+
+// Metrics is a server.Metrics recording, labelled by response status and
+// resource scheme:
+//
+//   - webfinger_server_requests_total, the number of queries;
+//   - webfinger_server_rel_filtered_requests_total, the number of queries
+//     filtering links by rel;
+//   - webfinger_server_request_duration_seconds, the latency of queries.
+type Metrics struct {
+	requests    *prometheus.CounterVec
+	relFiltered *prometheus.CounterVec
+	duration    *prometheus.HistogramVec
+}
+
+var _ server.Metrics = (*Metrics)(nil)
+
+var labels = []string{"status", "scheme"}
+
+// New returns Metrics registered with reg.  If reg is nil,
+// prometheus.DefaultRegisterer is used.
+func New(reg prometheus.Registerer) (*Metrics, error) {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+
+	m := &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "webfinger",
+			Subsystem: "server",
+			Name:      "requests_total",
+			Help:      "Number of WebFinger queries.",
+		}, labels),
+		relFiltered: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "webfinger",
+			Subsystem: "server",
+			Name:      "rel_filtered_requests_total",
+			Help:      "Number of WebFinger queries filtering links by rel.",
+		}, labels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "webfinger",
+			Subsystem: "server",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of WebFinger queries.",
+			Buckets:   prometheus.DefBuckets,
+		}, labels),
+	}
+	for _, c := range []prometheus.Collector{m.requests, m.relFiltered, m.duration} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// ObserveQuery implements server.Metrics.
+func (m *Metrics) ObserveQuery(q server.Query) {
+	values := []string{strconv.Itoa(q.Status), q.Scheme}
+	m.requests.WithLabelValues(values...).Inc()
+	if q.Rels > 0 {
+		m.relFiltered.WithLabelValues(values...).Inc()
+	}
+	m.duration.WithLabelValues(values...).Observe(q.Duration.Seconds())
+}
@@ -0,0 +1,60 @@
+package promwebfinger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/ant0ine/go-webfinger/jrd"
+	"github.com/ant0ine/go-webfinger/server"
+)
+
+func TestMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m, err := New(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := server.NewHandler(server.ResolverFunc(func(r *http.Request, resource string) (*jrd.JRD, error) {
+		if resource == "acct:bob@example.com" {
+			return &jrd.JRD{Subject: resource}, nil
+		}
+		return nil, server.ErrNotFound
+	}))
+	h.Metrics = m
+
+	for _, target := range []string{
+		server.Path + "?resource=acct%3Abob%40example.com",
+		server.Path + "?resource=acct%3Abob%40example.com&rel=self",
+		server.Path + "?resource=acct%3Aalice%40example.com",
+	} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", target, nil))
+	}
+
+	want := `
+# HELP webfinger_server_requests_total Number of WebFinger queries.
+# TYPE webfinger_server_requests_total counter
+webfinger_server_requests_total{scheme="acct",status="200"} 2
+webfinger_server_requests_total{scheme="acct",status="404"} 1
+# HELP webfinger_server_rel_filtered_requests_total Number of WebFinger queries filtering links by rel.
+# TYPE webfinger_server_rel_filtered_requests_total counter
+webfinger_server_rel_filtered_requests_total{scheme="acct",status="200"} 1
+`
+	err = testutil.GatherAndCompare(reg, strings.NewReader(want),
+		"webfinger_server_requests_total", "webfinger_server_rel_filtered_requests_total")
+	if err != nil {
+		t.Error(err)
+	}
+	if got := testutil.CollectAndCount(m.duration); got != 2 {
+		t.Errorf("Recorded %d latency series, want 2", got)
+	}
+
+	if _, err := New(reg); err == nil {
+		t.Error("Expected error registering twice")
+	}
+}
@@ -0,0 +1,114 @@
+package webfinger
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/ant0ine/go-webfinger/jrd"
+)
+
+// ErrNoSignature is returned, wrapped in a *SignatureError, when a signature is
+// required but the JRD is not signed.
+var ErrNoSignature = errors.New("JRD is not signed")
+
+// A SignatureError is returned when the signature of a JRD cannot be verified.
+type SignatureError struct {
+	// URL is the URL the JRD was fetched from.
+	URL string
+
+	Err error
+}
+
+func (e *SignatureError) Error() string {
+	return fmt.Sprintf("webfinger: invalid signature for %s: %v", e.URL, e.Err)
+}
+
+// Unwrap returns the underlying verification error.
+func (e *SignatureError) Unwrap() error {
+	return e.Err
+}
+
+// A KeySource provides the keys trusted to sign the JRDs of the resources of a
+// host.
+type KeySource interface {
+	// PublicKey returns the key identified by keyID (which may be empty) that
+	// host is trusted to sign JRDs with.  host is the WebFinger host of the
+	// resource looked up (the domain of acct: resources), not the host the
+	// JRD is served from, which may differ after redirects or WebFist
+	// delegation.
+	PublicKey(ctx context.Context, host, keyID string) (crypto.PublicKey, error)
+}
+
+// KeySourceFunc is an adapter to allow the use of ordinary functions as a
+// KeySource.
+type KeySourceFunc func(ctx context.Context, host, keyID string) (crypto.PublicKey, error)
+
+// PublicKey calls f(ctx, host, keyID).
+func (f KeySourceFunc) PublicKey(ctx context.Context, host, keyID string) (crypto.PublicKey, error) {
+	return f(ctx, host, keyID)
+}
+
+// TrustedKey is a key trusted to sign the JRDs of the resources of Host.
+type TrustedKey struct {
+	Host  string
+	KeyID string
+	Key   crypto.PublicKey
+}
+
+// StaticKeys is a KeySource backed by a fixed list of keys.
+type StaticKeys []TrustedKey
+
+// PublicKey returns the first key of s for host, whose KeyID matches keyID if
+// both are set.
+func (s StaticKeys) PublicKey(ctx context.Context, host, keyID string) (crypto.PublicKey, error) {
+	for _, k := range s {
+		if k.Host != host {
+			continue
+		}
+		if keyID != "" && k.KeyID != "" && keyID != k.KeyID {
+			continue
+		}
+		return k.Key, nil
+	}
+	return nil, fmt.Errorf("no trusted key for %s", host)
+}
+
+// verifySignature checks the signature of the JRD content served in res, with
+// the keys of signer.  A missing signature is an error only if required is
+// true, but a signature that is present is always verified when c has a
+// KeySource.
+func (c *Client) verifySignature(ctx context.Context, res *http.Response, content []byte, signer string, required bool) error {
+	jrdURL := res.Request.URL
+	header := res.Header.Get(jrd.SignatureHeader)
+	if header == "" {
+		if required {
+			return &SignatureError{jrdURL.String(), ErrNoSignature}
+		}
+		return nil
+	}
+	if c.KeySource == nil {
+		if required {
+			return &SignatureError{jrdURL.String(), errors.New("no KeySource configured")}
+		}
+		return nil
+	}
+
+	sig, err := jrd.ParseSignature(header)
+	if err != nil {
+		return &SignatureError{jrdURL.String(), err}
+	}
+	key, err := c.KeySource.PublicKey(ctx, signer, sig.KeyID)
+	if err != nil {
+		return &SignatureError{jrdURL.String(), err}
+	}
+	if err := sig.Verify(content, key); err != nil {
+		return &SignatureError{jrdURL.String(), err}
+	}
+
+	log.Printf("Verified JRD signature of %s from %s", signer, jrdURL.Host)
+	return nil
+}
@@ -0,0 +1,134 @@
+package webfinger
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/ant0ine/go-webfinger/jrd"
+)
+
+// serveSigned serves a JRD over plain HTTP, signed with key if not nil.
+func serveSigned(t *testing.T, key *ecdsa.PrivateKey) *httptest.Server {
+	body := []byte(`{"subject":"acct:bob@example.com"}`)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key != nil {
+			sig, err := jrd.Sign(body, key, "k1")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			w.Header().Set(jrd.SignatureHeader, sig)
+		}
+		w.Header().Add("content-type", "application/jrd+json")
+		w.Write(body)
+	}))
+}
+
+func TestFetchJRD_signature(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	plain := serveSigned(t, key)
+	defer plain.Close()
+	u, _ := url.Parse(plain.URL)
+
+	c := NewClient(nil)
+	c.SchemePolicy = HTTPOnlyForHosts(u.Host)
+	c.RequireSignatureOverHTTP = true
+	c.KeySource = StaticKeys{{Host: u.Host, KeyID: "k1", Key: &key.PublicKey}}
+
+	result, err := c.fetchJRD(context.Background(), u, u.Host, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got, want := result.JRD.Subject, "acct:bob@example.com"; got != want {
+		t.Errorf("Subject is %q, want %q", got, want)
+	}
+
+	// signed with an untrusted key
+	c.KeySource = StaticKeys{{Host: u.Host, Key: &other.PublicKey}}
+	_, err = c.fetchJRD(context.Background(), u, u.Host, false)
+	var serr *SignatureError
+	if !errors.As(err, &serr) {
+		t.Errorf("fetchJRD returned error %#v, want *SignatureError", err)
+	}
+}
+
+func TestFetchJRD_unsigned(t *testing.T) {
+	plain := serveSigned(t, nil)
+	defer plain.Close()
+	u, _ := url.Parse(plain.URL)
+
+	c := NewClient(nil)
+	c.SchemePolicy = HTTPOnlyForHosts(u.Host)
+	if _, err := c.fetchJRD(context.Background(), u, u.Host, false); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	c.RequireSignatureOverHTTP = true
+	_, err := c.fetchJRD(context.Background(), u, u.Host, false)
+	if !errors.Is(err, ErrNoSignature) {
+		t.Errorf("fetchJRD returned error %v, want %v", err, ErrNoSignature)
+	}
+}
+
+func TestWebFistLookup_requireSignature(t *testing.T) {
+	webFistSetup()
+	defer webFistTearDown()
+
+	mux.HandleFunc("/webfinger.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		w.Write([]byte(`{"subject":"bob@example.com"}`))
+	})
+	handleWebFist(t, server.URL+"/webfinger.json")
+	handleProof(t, server.URL+"/webfinger.json", wfKey)
+
+	client.RequireSignatureForWebFist = true
+	_, err := client.Lookup("bob@"+testHost, nil)
+	if !errors.Is(err, ErrNoSignature) {
+		t.Errorf("Lookup returned error %v, want %v", err, ErrNoSignature)
+	}
+}
+
+func TestFetchJRD_signatureAfterRedirect(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	attacker, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	// the attacker redirects the query to a host it controls, and signs with
+	// the key of that host
+	evil := serveSigned(t, attacker)
+	defer evil.Close()
+	evilURL, _ := url.Parse(evil.URL)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, evil.URL+"/jrd", http.StatusFound)
+	}))
+	defer origin.Close()
+	u, _ := url.Parse(origin.URL)
+
+	c := NewClient(nil)
+	c.SchemePolicy = HTTPOnlyForHosts(u.Host, evilURL.Host)
+	c.RequireSignatureOverHTTP = true
+	c.KeySource = KeySourceFunc(func(ctx context.Context, host, keyID string) (crypto.PublicKey, error) {
+		switch host {
+		case u.Host:
+			return &key.PublicKey, nil
+		case evilURL.Host:
+			return &attacker.PublicKey, nil
+		}
+		return nil, errors.New("unknown host")
+	})
+
+	_, err := c.fetchJRD(context.Background(), u, u.Host, false)
+	var serr *SignatureError
+	if !errors.As(err, &serr) {
+		t.Errorf("fetchJRD returned error %#v, want *SignatureError", err)
+	}
+}
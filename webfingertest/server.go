@@ -0,0 +1,261 @@
+// Package webfingertest provides a fake WebFinger server, to test code using
+// WebFinger clients without network.
+//
+// The server answers WebFinger and host-meta queries for a set of resources,
+// and runs a WebFist delegation server.  Server.Client returns a
+// webfinger.Client sending the queries of all hosts to the fake server.
+//
+// Example:
+//
+//	s := webfingertest.NewServer(map[string]*jrd.JRD{
+//		"acct:bob@example.com": {Subject: "acct:bob@example.com"},
+//	})
+//	defer s.Close()
+//
+//	j, err := s.Client().Lookup("bob@example.com", nil)
+package webfingertest
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ant0ine/go-webfinger"
+	"github.com/ant0ine/go-webfinger/dkim"
+	"github.com/ant0ine/go-webfinger/jrd"
+	"github.com/ant0ine/go-webfinger/server"
+	"github.com/ant0ine/go-webfinger/webfist"
+)
+
+const (
+	// HostMetaPath is the path of the XRD host-meta document.
+	HostMetaPath = "/.well-known/host-meta"
+
+	// HostMetaJSONPath is the path of the JRD host-meta document.
+	HostMetaJSONPath = "/.well-known/host-meta.json"
+
+	// DelegatedPath is the path prefix JRDs delegated with Delegate are
+	// served at.
+	DelegatedPath = "/webfingertest/delegated/"
+
+	// DKIMSelector is the DKIM selector of the delegation emails signed by
+	// Delegate.
+	DKIMSelector = "webfingertest"
+)
+
+// Server is a fake WebFinger server, serving the JRDs of its resources over
+// HTTPS.  It must be closed with Close.
+type Server struct {
+	*httptest.Server
+
+	// WebFist is the WebFist delegation server.
+	WebFist *httptest.Server
+
+	mu        sync.RWMutex
+	resources map[string]*jrd.JRD
+	delegated map[string]*jrd.JRD
+	requests  []string
+
+	webfist *webfist.Server
+	dkimKey *rsa.PrivateKey
+	dkimTXT string
+}
+
+// NewServer starts a Server serving resources, a map from resource URIs to
+// their JRD.  The map is copied.
+func NewServer(resources map[string]*jrd.JRD) *Server {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		panic(fmt.Sprintf("webfingertest: cannot generate DKIM key: %v", err))
+	}
+	txt, err := dkim.TXTRecord(&key.PublicKey)
+	if err != nil {
+		panic(fmt.Sprintf("webfingertest: cannot encode DKIM key: %v", err))
+	}
+
+	s := &Server{
+		resources: map[string]*jrd.JRD{},
+		delegated: map[string]*jrd.JRD{},
+		dkimKey:   key,
+		dkimTXT:   txt,
+	}
+	for resource, j := range resources {
+		s.resources[resource] = j
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(server.Path, server.NewHandler(server.ResolverFunc(s.resolve)))
+	mux.HandleFunc(HostMetaPath, s.serveHostMeta)
+	mux.HandleFunc(HostMetaJSONPath, s.serveHostMeta)
+	mux.HandleFunc(DelegatedPath, s.serveDelegated)
+	s.Server = httptest.NewTLSServer(s.record(mux))
+
+	s.webfist = webfist.NewServer(webfist.NewMemoryStore(), s)
+	s.WebFist = httptest.NewTLSServer(s.record(s.webfist))
+	return s
+}
+
+// Close shuts down the servers.
+func (s *Server) Close() {
+	s.Server.Close()
+	s.WebFist.Close()
+}
+
+// Host returns the host and port of the WebFinger server.
+func (s *Server) Host() string {
+	return hostOf(s.Server)
+}
+
+// WebFistHost returns the host and port of the WebFist server.
+func (s *Server) WebFistHost() string {
+	return hostOf(s.WebFist)
+}
+
+func hostOf(s *httptest.Server) string {
+	u, _ := url.Parse(s.URL)
+	return u.Host
+}
+
+// Set sets the JRD of resource.
+func (s *Server) Set(resource string, j *jrd.JRD) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resources[resource] = j
+}
+
+// Delete removes resource.
+func (s *Server) Delete(resource string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.resources, resource)
+}
+
+// Delegate serves j, and delegates email to it on the WebFist server with a
+// delegation email signed by a DKIM key of the domain of email.  The DKIM key
+// is returned by LookupTXT.
+func (s *Server) Delegate(email string, j *jrd.JRD) error {
+	email = strings.ToLower(email)
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return fmt.Errorf("webfingertest: invalid email address %q", email)
+	}
+
+	s.mu.Lock()
+	s.delegated[email] = j
+	s.mu.Unlock()
+
+	message := "From: <" + email + ">\r\n" +
+		"To: delegate@" + webfist.DefaultServer + "\r\n" +
+		"Subject: WebFist delegation\r\n" +
+		"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+		"\r\n" +
+		"webfist = " + s.URL + DelegatedPath + url.PathEscape(email) + "\r\n"
+	signed, err := dkim.Sign([]byte(message), email[at+1:], DKIMSelector, s.dkimKey, nil)
+	if err != nil {
+		return err
+	}
+	_, err = s.webfist.Receive(context.Background(), signed)
+	return err
+}
+
+// LookupTXT implements dkim.TXTResolver, serving the DKIM key signing the
+// delegation emails of all domains.
+func (s *Server) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if strings.HasPrefix(name, DKIMSelector+"._domainkey.") {
+		return []string{s.dkimTXT}, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+// Requests returns the requests served so far, as "METHOD host/path?query".
+func (s *Server) Requests() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string(nil), s.requests...)
+}
+
+// Client returns a new webfinger.Client trusting the servers, issuing the
+// WebFinger queries of all hosts to the fake server, and falling back to its
+// WebFist server.
+func (s *Server) Client() *webfinger.Client {
+	c := webfinger.NewClient(s.Server.Client())
+	c.HostResolver = webfinger.HostResolverFunc(func(ctx context.Context, host string) (*url.URL, error) {
+		return &url.URL{Host: s.Host()}, nil
+	})
+	c.WebFistServers = []string{s.WebFistHost()}
+	c.DKIMResolver = s
+	return c
+}
+
+func (s *Server) record(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Method+" "+r.Host+r.URL.RequestURI())
+		s.mu.Unlock()
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) resolve(r *http.Request, resource string) (*jrd.JRD, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	j, ok := s.resources[resource]
+	if !ok {
+		return nil, server.ErrNotFound
+	}
+	return j, nil
+}
+
+func (s *Server) serveDelegated(w http.ResponseWriter, r *http.Request) {
+	email, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), DelegatedPath))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.RLock()
+	j, ok := s.delegated[email]
+	s.mu.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, err := json.Marshal(j)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", server.ContentType)
+	w.Write(body)
+}
+
+// serveHostMeta serves the host-meta document, in XRD or JRD, pointing to the
+// WebFinger endpoint.
+func (s *Server) serveHostMeta(w http.ResponseWriter, r *http.Request) {
+	template := "https://" + r.Host + server.Path + "?resource={uri}"
+	if r.URL.Path == HostMetaJSONPath {
+		body, _ := json.Marshal(map[string]interface{}{
+			"links": []map[string]string{{"rel": "lrdd", "template": template}},
+		})
+		w.Header().Set("Content-Type", server.ContentType)
+		w.Write(body)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xrd+xml")
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<XRD xmlns="http://docs.oasis-open.org/ns/xri/xrd-1.0">
+  <Link rel="lrdd" type="application/jrd+json" template="%s"/>
+</XRD>
+`, template)
+}
@@ -0,0 +1,93 @@
+package webfingertest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/ant0ine/go-webfinger"
+	"github.com/ant0ine/go-webfinger/jrd"
+)
+
+func TestServer(t *testing.T) {
+	s := NewServer(map[string]*jrd.JRD{
+		"acct:bob@example.com": {Subject: "acct:bob@example.com"},
+	})
+	defer s.Close()
+	c := s.Client()
+
+	j, err := c.Lookup("bob@example.com", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got, want := j.Subject, "acct:bob@example.com"; got != want {
+		t.Errorf("Subject is %q, want %q", got, want)
+	}
+
+	s.Delete("acct:bob@example.com")
+	if _, err := c.Lookup("bob@example.com", nil); err == nil {
+		t.Error("Expected error looking up a deleted resource")
+	}
+
+	s.Set("acct:alice@example.org", &jrd.JRD{Subject: "acct:alice@example.org"})
+	if _, err := c.Lookup("alice@example.org", nil); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestServer_webfist(t *testing.T) {
+	s := NewServer(nil)
+	defer s.Close()
+
+	if err := s.Delegate("Carol@example.net", &jrd.JRD{Subject: "acct:carol@example.net"}); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := s.Client().LookupWithInfo("carol@example.net", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got, want := result.Strategy, webfinger.StrategyWebFist; got != want {
+		t.Errorf("Strategy is %q, want %q", got, want)
+	}
+	if got, want := result.JRD.Subject, "acct:carol@example.net"; got != want {
+		t.Errorf("Subject is %q, want %q", got, want)
+	}
+}
+
+func TestServer_hostMeta(t *testing.T) {
+	s := NewServer(nil)
+	defer s.Close()
+
+	res, err := s.Server.Client().Get(s.URL + HostMetaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if want := `template="https://` + s.Host() + `/.well-known/webfinger?resource={uri}"`; !strings.Contains(string(body), want) {
+		t.Errorf("host-meta %s does not contain %s", body, want)
+	}
+	if got := len(s.Requests()); got != 1 {
+		t.Errorf("Recorded %d requests, want 1", got)
+	}
+}
+
+func Example() {
+	s := NewServer(map[string]*jrd.JRD{
+		"acct:bob@example.com": {
+			Subject: "acct:bob@example.com",
+			Links:   []jrd.Link{{Rel: jrd.RelProfilePage, Href: "https://example.com/@bob"}},
+		},
+	})
+	defer s.Close()
+
+	j, err := s.Client().Lookup("bob@example.com", nil)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(j.GetLinkByRel(jrd.RelProfilePage).Href)
+	// Output: https://example.com/@bob
+}
@@ -1,24 +1,135 @@
 package webfinger
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"net"
 	"net/url"
+	"strings"
 
-	"github.com/ant0ine/go-webfinger/jrd"
+	"github.com/ant0ine/go-webfinger/dkim"
+	"github.com/ant0ine/go-webfinger/webfist"
 )
 
 const (
-	webFistDefaultServer = "webfist.org"
-	webFistRel           = "http://webfist.org/spec/rel"
+	webFistDefaultServer = webfist.DefaultServer
+	webFistRel           = webfist.Rel
 )
 
-func (c *Client) webfistLookup(resource *Resource) (*jrd.JRD, error) {
-	jrdURL := resource.JRDURL(c.WebFistServer, nil)
-	webfistJRD, err := c.fetchJRD(jrdURL)
+// A WebFistError is returned when the lookup fails on all WebFist servers.
+type WebFistError struct {
+	// Servers are the WebFist servers queried.
+	Servers []string
+
+	// Errors are the errors returned by each of Servers.
+	Errors []error
+}
+
+func (e *WebFistError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = fmt.Sprintf("%s: %v", e.Servers[i], err)
+	}
+	return "WebFist lookup failed: " + strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the errors returned by each server.
+func (e *WebFistError) Unwrap() []error {
+	return e.Errors
+}
+
+// webfistServers returns the WebFist servers to query, if any.
+func (c *Client) webfistServers() []string {
+	if c.DisableWebFist {
+		return nil
+	}
+	if c.WebFistServers != nil {
+		return c.WebFistServers
+	}
+	if c.WebFistServer != "" {
+		return []string{c.WebFistServer}
+	}
+	return nil
+}
+
+// webfistFallback looks up resource on servers, and returns the first JRD
+// successfully delegated.  If there is a single server, its error is returned
+// as is, otherwise a *WebFistError is returned.
+func (c *Client) webfistFallback(ctx context.Context, resource *Resource, servers []string) (result *fetchResult, err error) {
+	ctx, end := c.instrumentation().StartFallback(ctx, resource, servers)
+	defer func() { end(err) }()
+
+	errs := make([]error, len(servers))
+
+	if c.WebFistParallel {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		type serverResult struct {
+			i      int
+			result *fetchResult
+			err    error
+		}
+		results := make(chan serverResult, len(servers))
+		for i, server := range servers {
+			go func(i int, server string) {
+				result, err := c.webfistServerLookup(ctx, resource, server)
+				results <- serverResult{i, result, err}
+			}(i, server)
+		}
+		for range servers {
+			r := <-results
+			if r.err == nil {
+				return r.result, nil
+			}
+			errs[r.i] = r.err
+		}
+	} else {
+		for i, server := range servers {
+			result, err := c.webfistServerLookup(ctx, resource, server)
+			if err == nil {
+				return result, nil
+			}
+			log.Printf("WebFist lookup on %s failed: %v", server, err)
+			errs[i] = err
+		}
+	}
+
+	if len(servers) == 1 {
+		return nil, errs[0]
+	}
+	return nil, &WebFistError{servers, errs}
+}
+
+// webfistServerLookup looks up resource on server, within c.WebFistTimeout.
+func (c *Client) webfistServerLookup(ctx context.Context, resource *Resource, server string) (*fetchResult, error) {
+	if c.WebFistTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.WebFistTimeout)
+		defer cancel()
+	}
+
+	ctx, end := c.instrumentation().StartWebFist(ctx, resource, server)
+	result, err := c.webfistLookup(ctx, resource, server)
+	end(err)
+	return result, err
+}
+
+func (c *Client) webfistLookup(ctx context.Context, resource *Resource, server string) (*fetchResult, error) {
+	email := resource.email()
+	if email == "" {
+		return nil, fmt.Errorf("No email address for WebFist lookup of %s", resource)
+	}
+
+	jrdURL := resource.JRDURL(server, nil)
+	webfistResult, err := c.fetchJRD(ctx, jrdURL, server, false)
 	if err != nil {
 		return nil, err
 	}
+	webfistJRD := webfistResult.JRD
 
 	link := webfistJRD.GetLinkByRel(webFistRel)
 	if link == nil {
@@ -29,7 +140,75 @@ func (c *Client) webfistLookup(resource *Resource) (*jrd.JRD, error) {
 	if err != nil {
 		return nil, err
 	}
+	// the delegated JRD is subject to the same scheme policy as direct
+	// queries, so that it cannot be used to downgrade to plain HTTP
+	if !c.allowsScheme(u) {
+		return nil, fmt.Errorf("WebFist link not allowed by the scheme policy: %s", u)
+	}
+
+	// only trust the delegated JRD if the DKIM-signed proof binds the email
+	// address to its URL
+	proofHref, _ := link.Properties[webfist.ProofProperty].(string)
+	if proofHref == "" {
+		return nil, fmt.Errorf("No WebFist proof")
+	}
+	proofURL, err := webfistResult.URL.Parse(proofHref)
+	if err != nil {
+		return nil, err
+	}
+	proof, err := c.fetchProof(ctx, proofURL)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := webfist.VerifyProof(ctx, proof, email, link.Href, c.txtResolver()); err != nil {
+		return nil, err
+	}
 
 	log.Printf("Found WebFist link: %s", u)
-	return c.fetchJRD(u)
+	// the delegated JRD must be signed by the domain of the resource, not by
+	// the host it is delegated to
+	result, err := c.fetchURL(ctx, u, resource.WebFingerHost(), c.RequireSignatureForWebFist)
+	if err != nil {
+		return nil, err
+	}
+	result.WebFistServer = server
+	return result, nil
+}
+
+func (c *Client) fetchProof(ctx context.Context, proofURL *url.URL) ([]byte, error) {
+	log.Printf("GET %s", proofURL.String())
+	res, err := c.get(ctx, proofURL.String())
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if !(200 <= res.StatusCode && res.StatusCode < 300) {
+		return nil, errors.New(res.Status)
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
+func (c *Client) txtResolver() dkim.TXTResolver {
+	if c.DKIMResolver != nil {
+		return c.DKIMResolver
+	}
+	return net.DefaultResolver
+}
+
+// email returns the email address of acct: and mailto: resources, without the
+// port WebFinger hosts may carry, or an empty string for other resources.
+func (r *Resource) email() string {
+	if r.Scheme != "acct" && r.Scheme != "mailto" {
+		return ""
+	}
+	parts := strings.SplitN(r.Opaque, "@", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	host := parts[1]
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return parts[0] + "@" + host
 }
@@ -0,0 +1,245 @@
+package webfist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ant0ine/go-webfinger/dkim"
+	"github.com/ant0ine/go-webfinger/jrd"
+	"github.com/ant0ine/go-webfinger/server"
+)
+
+const (
+	// DelegatePath is the path delegation emails are uploaded to.
+	DelegatePath = "/webfist/delegate"
+
+	// ProofPath is the path prefix delegation proofs are served at.
+	ProofPath = "/webfist/proof/"
+)
+
+// maxEmailSize is the maximum size of an uploaded delegation email.
+const maxEmailSize = 1 << 20
+
+// maxClockSkew is how far in the future delegation emails may be dated.
+const maxClockSkew = time.Hour
+
+var (
+	// ErrNotFound is returned by a Store when it has no delegation for an
+	// email address.
+	ErrNotFound = errors.New("webfist: no delegation")
+
+	// ErrStale is returned by Server.Receive for a delegation email older
+	// than the stored delegation of its sender, such as a replayed proof.
+	ErrStale = errors.New("webfist: delegation older than the stored one")
+)
+
+// Record is a verified delegation, with its proof.
+type Record struct {
+	Delegation
+
+	// Proof is the raw DKIM-signed delegation email.
+	Proof []byte
+}
+
+// A Store persists the delegations received by a Server.
+type Store interface {
+	// Put stores rec, replacing any previous delegation of rec.Email.
+	Put(ctx context.Context, rec *Record) error
+
+	// Get returns the delegation of email, or ErrNotFound.
+	Get(ctx context.Context, email string) (*Record, error)
+}
+
+// MemoryStore is a Store keeping delegations in memory.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	records map[string]*Record
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: map[string]*Record{}}
+}
+
+// Put stores rec.
+func (s *MemoryStore) Put(ctx context.Context, rec *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[strings.ToLower(rec.Email)] = rec
+	return nil
+}
+
+// Get returns the delegation of email.
+func (s *MemoryStore) Get(ctx context.Context, email string) (*Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.records[strings.ToLower(email)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return rec, nil
+}
+
+// Server is a WebFist delegation server.  It receives DKIM-signed delegation
+// emails, and answers WebFinger queries for the delegating addresses with a
+// link to the delegated JRD and to the proof of the delegation.
+//
+// Delegation emails are uploaded with a POST request at DelegatePath, or
+// handed to Receive by an SMTP server.
+type Server struct {
+	// Store persists the delegations.
+	Store Store
+
+	// Resolver looks up the DKIM keys used to verify delegation emails.
+	Resolver dkim.TXTResolver
+
+	// BaseURL is the absolute URL the server is reachable at (e.g.
+	// "https://webfist.example"), which proof URLs are built from.  If empty,
+	// proof URLs are relative to the server.
+	BaseURL string
+
+	// mu serializes the updates of Store by Receive.
+	mu  sync.Mutex
+	mux *http.ServeMux
+}
+
+// NewServer returns a new Server storing delegations in store, and verifying
+// them with the DKIM keys looked up by resolver.
+func NewServer(store Store, resolver dkim.TXTResolver) *Server {
+	s := &Server{Store: store, Resolver: resolver, mux: http.NewServeMux()}
+	s.mux.Handle(server.Path, server.NewHandler(server.ResolverFunc(s.resolve)))
+	s.mux.HandleFunc(DelegatePath, s.serveDelegate)
+	s.mux.HandleFunc(ProofPath, s.serveProof)
+	return s
+}
+
+// ServeHTTP dispatches the request to the WebFinger, upload or proof handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Receive verifies the raw delegation email message and stores the
+// delegation.  The message must be dated, and not older than the stored
+// delegation of its sender, otherwise ErrStale is returned, so that replaying
+// an old proof cannot roll back a delegation.
+func (s *Server) Receive(ctx context.Context, message []byte) (*Delegation, error) {
+	d, err := ParseDelegation(message)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(d.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("webfist: delegation to %q is not an absolute http URL", d.URL)
+	}
+	if d.Date.IsZero() {
+		return nil, errors.New("webfist: delegation email has no Date header")
+	}
+	if d.Date.After(time.Now().Add(maxClockSkew)) {
+		return nil, fmt.Errorf("webfist: delegation email dated in the future: %s", d.Date)
+	}
+	if _, err := VerifyProof(ctx, message, d.Email, d.URL, s.Resolver); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, err := s.Store.Get(ctx, d.Email)
+	switch {
+	case errors.Is(err, ErrNotFound):
+	case err != nil:
+		return nil, err
+	case d.Date.Before(prev.Date):
+		return nil, ErrStale
+	}
+	if err := s.Store.Put(ctx, &Record{Delegation: *d, Proof: message}); err != nil {
+		return nil, err
+	}
+	log.Printf("Stored WebFist delegation of %s to %s", d.Email, d.URL)
+	return d, nil
+}
+
+func (s *Server) serveDelegate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	message, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxEmailSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	d, err := s.Receive(r.Context(), message)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Location", s.proofURL(d.Email))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) serveProof(w http.ResponseWriter, r *http.Request) {
+	email, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), ProofPath))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	rec, err := s.Store.Get(r.Context(), email)
+	if errors.Is(err, ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Cannot get WebFist delegation of %s: %v", email, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "message/rfc822")
+	w.Write(rec.Proof)
+}
+
+// resolve returns the WebFist JRD of acct: and mailto: resources.
+func (s *Server) resolve(r *http.Request, resource string) (*jrd.JRD, error) {
+	u, err := url.Parse(resource)
+	if err != nil || (u.Scheme != "acct" && u.Scheme != "mailto") {
+		return nil, server.ErrNotFound
+	}
+
+	rec, err := s.Store.Get(r.Context(), u.Opaque)
+	if errors.Is(err, ErrNotFound) {
+		return nil, server.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &jrd.JRD{
+		Subject: resource,
+		Links: []jrd.Link{{
+			Rel:  Rel,
+			Href: rec.URL,
+			Properties: map[string]interface{}{
+				ProofProperty: s.proofURL(rec.Email),
+			},
+		}},
+	}, nil
+}
+
+// proofURL returns the URL of the proof of email, relative to the server if
+// s.BaseURL is not set.  The Host header of requests is not trusted to build
+// absolute URLs.
+func (s *Server) proofURL(email string) string {
+	return strings.TrimSuffix(s.BaseURL, "/") + ProofPath + url.PathEscape(email)
+}
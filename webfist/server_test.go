@@ -0,0 +1,132 @@
+package webfist
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/ant0ine/go-webfinger/dkim"
+	"github.com/ant0ine/go-webfinger/jrd"
+	"github.com/ant0ine/go-webfinger/server"
+)
+
+func TestServer(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 1024)
+	txt, _ := dkim.TXTRecord(&key.PublicKey)
+	resolver := fakeResolver{"s1._domainkey.example.com": txt}
+
+	s := httptest.NewServer(NewServer(NewMemoryStore(), resolver))
+	defer s.Close()
+
+	// unsigned delegation is rejected
+	res, err := http.Post(s.URL+DelegatePath, "message/rfc822", bytes.NewReader([]byte(delegation)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if got, want := res.StatusCode, http.StatusBadRequest; got != want {
+		t.Errorf("Unsigned upload returned status %d, want %d", got, want)
+	}
+
+	signed, _ := dkim.Sign([]byte(delegation), "example.com", "s1", key, nil)
+	res, err = http.Post(s.URL+DelegatePath, "message/rfc822", bytes.NewReader(signed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if got, want := res.StatusCode, http.StatusCreated; got != want {
+		t.Fatalf("Upload returned status %d, want %d", got, want)
+	}
+
+	res, err = http.Get(s.URL + server.Path + "?resource=" + url.QueryEscape("acct:bob@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	j, err := jrd.ParseJRD(body)
+	if err != nil {
+		t.Fatalf("Cannot parse JRD %s: %v", body, err)
+	}
+	link := j.GetLinkByRel(Rel)
+	if link == nil {
+		t.Fatalf("JRD %s has no WebFist link", body)
+	}
+	if got, want := link.Href, "https://example.net/bob.json"; got != want {
+		t.Errorf("WebFist link is %q, want %q", got, want)
+	}
+
+	// the proof verifies, as a client would check it
+	proofURL, err := res.Request.URL.Parse(link.GetProperty(ProofProperty))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err = http.Get(proofURL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if _, err := VerifyProof(context.Background(), proof, "bob@example.com", link.Href, resolver); err != nil {
+		t.Errorf("VerifyProof returned error: %v", err)
+	}
+
+	res, err = http.Get(s.URL + server.Path + "?resource=" + url.QueryEscape("acct:alice@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if got, want := res.StatusCode, http.StatusNotFound; got != want {
+		t.Errorf("Unknown resource returned status %d, want %d", got, want)
+	}
+}
+
+func TestServer_Receive(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 1024)
+	txt, _ := dkim.TXTRecord(&key.PublicKey)
+	resolver := fakeResolver{"s1._domainkey.example.com": txt}
+	s := NewServer(NewMemoryStore(), resolver)
+	s.BaseURL = "https://webfist.example/"
+
+	message := func(date, url string) []byte {
+		signed, _ := dkim.Sign([]byte("From: <bob@example.com>\r\n"+
+			"Subject: WebFist delegation\r\n"+
+			date+
+			"\r\n"+
+			"webfist = "+url+"\r\n"), "example.com", "s1", key, nil)
+		return signed
+	}
+	old := message("Date: Mon, 02 Jan 2006 15:04:05 +0000\r\n", "https://example.net/old.json")
+	recent := message("Date: Tue, 03 Jan 2006 15:04:05 +0000\r\n", "https://example.net/new.json")
+
+	if _, err := s.Receive(context.Background(), message("", "https://example.net/bob.json")); err == nil {
+		t.Error("Receive accepted a delegation email without Date")
+	}
+	if _, err := s.Receive(context.Background(), old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Receive(context.Background(), recent); err != nil {
+		t.Fatal(err)
+	}
+	// replaying the old proof does not roll back the delegation
+	if _, err := s.Receive(context.Background(), old); err != ErrStale {
+		t.Errorf("Receive returned %v for a replayed delegation, want %v", err, ErrStale)
+	}
+	rec, err := s.Store.Get(context.Background(), "bob@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rec.URL, "https://example.net/new.json"; got != want {
+		t.Errorf("Delegation URL is %q, want %q", got, want)
+	}
+
+	if got, want := s.proofURL("bob@example.com"), "https://webfist.example"+ProofPath+"bob@example.com"; got != want {
+		t.Errorf("proofURL returned %q, want %q", got, want)
+	}
+}
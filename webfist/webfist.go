@@ -0,0 +1,154 @@
+// Package webfist implements the parts of the WebFist protocol shared by
+// clients and servers: delegation emails, and the DKIM proofs binding an
+// email address to the URL of its JRD.
+//
+// Following this spec: http://webfist.org/
+package webfist
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ant0ine/go-webfinger/dkim"
+)
+
+const (
+	// DefaultServer is the default WebFist server.
+	DefaultServer = "webfist.org"
+
+	// Rel is the rel value of the link to the delegated JRD.
+	Rel = "http://webfist.org/spec/rel"
+
+	// ProofProperty is the link property holding the URL of the delegation
+	// proof, the raw DKIM-signed delegation email.
+	ProofProperty = "http://webfist.org/spec/proof"
+)
+
+// ErrNoDelegation is returned by ParseDelegation when the email body has no
+// "webfist = <url>" line.
+var ErrNoDelegation = errors.New("webfist: no delegation in email")
+
+// Delegation binds an email address to the URL of its JRD.
+type Delegation struct {
+	// Email is the delegating email address, from the From header.
+	Email string
+
+	// URL is the URL of the delegated JRD.
+	URL string
+
+	// Date is the date of the email, from the Date header, or the zero time
+	// if it has none.
+	Date time.Time
+}
+
+var delegationLine = regexp.MustCompile(`(?i)^\s*webfist\s*=\s*(\S+)\s*$`)
+
+// ParseDelegation extracts the delegation from the raw email message.  The
+// delegated URL is given by a "webfist = <url>" line in the body.  Messages
+// with several From or Date headers are rejected, as the sender or date would
+// be ambiguous.
+func ParseDelegation(message []byte) (*Delegation, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(message))
+	if err != nil {
+		return nil, err
+	}
+	if n := len(msg.Header["From"]); n != 1 {
+		return nil, fmt.Errorf("webfist: message has %d From headers, want 1", n)
+	}
+	from, err := mail.ParseAddress(msg.Header.Get("From"))
+	if err != nil {
+		return nil, fmt.Errorf("webfist: invalid From header: %v", err)
+	}
+	var date time.Time
+	switch n := len(msg.Header["Date"]); {
+	case n > 1:
+		return nil, fmt.Errorf("webfist: message has %d Date headers, want 1", n)
+	case n == 1:
+		if date, err = msg.Header.Date(); err != nil {
+			return nil, fmt.Errorf("webfist: invalid Date header: %v", err)
+		}
+	}
+	body, err := ioutil.ReadAll(msg.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		if m := delegationLine.FindStringSubmatch(scanner.Text()); m != nil {
+			return &Delegation{Email: strings.ToLower(from.Address), URL: m[1], Date: date}, nil
+		}
+	}
+	return nil, ErrNoDelegation
+}
+
+// A ProofError is returned by VerifyProof when a proof does not bind the
+// email address to the URL.
+type ProofError struct {
+	Email  string
+	Reason string
+}
+
+func (e *ProofError) Error() string {
+	return fmt.Sprintf("webfist: invalid proof for %s: %s", e.Email, e.Reason)
+}
+
+// VerifyProof checks that message, a delegation email, is DKIM-signed by the
+// domain of its sender, and that it delegates email to jrdURL.  DKIM keys are
+// looked up with resolver.
+//
+// The signature must cover the whole body, and oversign the From header, so
+// that neither a From header nor a delegation line can be added to a message
+// signed for another sender.  The Date header, if any, must be signed too.
+func VerifyProof(ctx context.Context, message []byte, email, jrdURL string, resolver dkim.TXTResolver) (*Delegation, error) {
+	d, err := ParseDelegation(message)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(d.Email, email) {
+		return nil, &ProofError{email, fmt.Sprintf("sent by %s", d.Email)}
+	}
+	if d.URL != jrdURL {
+		return nil, &ProofError{email, fmt.Sprintf("delegates to %s", d.URL)}
+	}
+
+	sigs, err := dkim.Verify(ctx, message, resolver)
+	if err != nil {
+		return nil, &ProofError{email, err.Error()}
+	}
+	domain := strings.ToLower(email[strings.LastIndex(email, "@")+1:])
+	reason := "not signed by " + domain
+	for _, sig := range sigs {
+		if domain != sig.Domain && !strings.HasSuffix(domain, "."+sig.Domain) {
+			continue
+		}
+		switch {
+		case sig.BodyLength >= 0:
+			reason = "signature does not cover the whole body"
+		case !sig.Oversigns("From"):
+			reason = "From header not oversigned"
+		case !signedFrom(sig, d.Email):
+			reason = fmt.Sprintf("signed From header is %q", sig.From)
+		case !d.Date.IsZero() && !sig.Signs("Date"):
+			reason = "Date header not signed"
+		default:
+			return d, nil
+		}
+	}
+	return nil, &ProofError{email, reason}
+}
+
+// signedFrom reports whether email is the address of the From header signed
+// by sig.
+func signedFrom(sig *dkim.Signature, email string) bool {
+	from, err := mail.ParseAddress(sig.From)
+	return err == nil && strings.EqualFold(from.Address, email)
+}
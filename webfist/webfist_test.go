@@ -0,0 +1,122 @@
+package webfist
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+
+	"github.com/ant0ine/go-webfinger/dkim"
+)
+
+// fakeResolver serves DNS TXT records from a map.
+type fakeResolver map[string]string
+
+func (r fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if txt, ok := r[name]; ok {
+		return []string{txt}, nil
+	}
+	return nil, errors.New("no such host")
+}
+
+const delegation = "From: Bob <Bob@example.com>\r\n" +
+	"To: delegate@webfist.org\r\n" +
+	"Subject: WebFist delegation\r\n" +
+	"Date: Mon, 02 Jan 2006 15:04:05 +0000\r\n" +
+	"\r\n" +
+	"Hello WebFist,\r\n" +
+	"  webfist = https://example.net/bob.json \r\n"
+
+func TestParseDelegation(t *testing.T) {
+	d, err := ParseDelegation([]byte(delegation))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := d.Email, "bob@example.com"; got != want {
+		t.Errorf("Delegation.Email is %q, want %q", got, want)
+	}
+	if got, want := d.URL, "https://example.net/bob.json"; got != want {
+		t.Errorf("Delegation.URL is %q, want %q", got, want)
+	}
+
+	_, err = ParseDelegation([]byte("From: bob@example.com\r\n\r\nhello\r\n"))
+	if err != ErrNoDelegation {
+		t.Errorf("ParseDelegation returned %v, want %v", err, ErrNoDelegation)
+	}
+}
+
+func TestVerifyProof(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 1024)
+	txt, _ := dkim.TXTRecord(&key.PublicKey)
+	resolver := fakeResolver{"s1._domainkey.example.com": txt}
+
+	signed, err := dkim.Sign([]byte(delegation), "example.com", "s1", key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := VerifyProof(context.Background(), signed, "bob@example.com", "https://example.net/bob.json", resolver); err != nil {
+		t.Errorf("VerifyProof returned error: %v", err)
+	}
+
+	tests := []struct {
+		email, url string
+	}{
+		{"alice@example.com", "https://example.net/bob.json"},
+		{"bob@example.com", "https://example.net/alice.json"},
+	}
+	for _, tt := range tests {
+		_, err := VerifyProof(context.Background(), signed, tt.email, tt.url, resolver)
+		if _, ok := err.(*ProofError); !ok {
+			t.Errorf("VerifyProof(%q, %q) returned %v, want *ProofError", tt.email, tt.url, err)
+		}
+	}
+
+	// signed by another domain
+	resolver = fakeResolver{"s1._domainkey.example.org": txt}
+	signed, _ = dkim.Sign([]byte(delegation), "example.org", "s1", key, nil)
+	_, err = VerifyProof(context.Background(), signed, "bob@example.com", "https://example.net/bob.json", resolver)
+	if _, ok := err.(*ProofError); !ok {
+		t.Errorf("VerifyProof returned %v for foreign signature, want *ProofError", err)
+	}
+}
+
+func TestVerifyProof_forgedFrom(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 1024)
+	txt, _ := dkim.TXTRecord(&key.PublicKey)
+	resolver := fakeResolver{"s1._domainkey.mail.example": txt}
+
+	message := "From: mallory@mail.example\r\n" +
+		"To: delegate@webfist.org\r\n" +
+		"\r\n" +
+		"webfist = https://evil.example/jrd\r\n"
+
+	for _, headers := range [][]string{nil, {"From", "To"}} {
+		signed, err := dkim.Sign([]byte(message), "mail.example", "s1", key, headers)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// an unsigned From header added on top of a valid signature
+		forged := append([]byte("From: victim@mail.example\r\n"), signed...)
+		if d, err := VerifyProof(context.Background(), forged, "victim@mail.example", "https://evil.example/jrd", resolver); err == nil {
+			t.Errorf("VerifyProof accepted a forged delegation %+v signed with headers %v", d, headers)
+		}
+	}
+}
+
+func TestVerifyProof_notOversigned(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 1024)
+	txt, _ := dkim.TXTRecord(&key.PublicKey)
+	resolver := fakeResolver{"s1._domainkey.example.com": txt}
+
+	signed, err := dkim.Sign([]byte(delegation), "example.com", "s1", key, []string{"From", "To", "Subject"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = VerifyProof(context.Background(), signed, "bob@example.com", "https://example.net/bob.json", resolver)
+	if _, ok := err.(*ProofError); !ok {
+		t.Errorf("VerifyProof returned %v for a From header not oversigned, want *ProofError", err)
+	}
+}
@@ -1,22 +1,43 @@
 package webfinger
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/ant0ine/go-webfinger/dkim"
 	"github.com/ant0ine/go-webfinger/jrd"
+	"github.com/ant0ine/go-webfinger/webfist"
 )
 
 var (
 	wfMux      *http.ServeMux
 	wfServer   *httptest.Server
 	wfTestHost string
+
+	// wfKey is the DKIM key of the test email domain.
+	wfKey *rsa.PrivateKey
 )
 
+// fakeTXTResolver serves DNS TXT records from a map.
+type fakeTXTResolver map[string]string
+
+func (r fakeTXTResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if txt, ok := r[name]; ok {
+		return []string{txt}, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
 func webFistSetup() {
 	setup()
 
@@ -26,23 +47,39 @@ func webFistSetup() {
 	wfTestHost = u.Host
 
 	client.WebFistServer = wfTestHost
-}
 
-func webFistTearDown() {
-	teardown()
-	wfServer.Close()
+	// the test email domain is the host name of the test server
+	wfKey, _ = rsa.GenerateKey(rand.Reader, 1024)
+	txt, _ := dkim.TXTRecord(&wfKey.PublicKey)
+	client.DKIMResolver = fakeTXTResolver{"test._domainkey." + testHostname(): txt}
 }
 
-func TestWebFistLookup(t *testing.T) {
-	webFistSetup()
-	defer webFistTearDown()
+// testHostname returns the host name of the test server, without its port.
+func testHostname() string {
+	host, _, _ := net.SplitHostPort(testHost)
+	return host
+}
 
-	mux.HandleFunc("/webfinger.json", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Add("content-type", "application/jrd+json")
-		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+// handleProof serves a delegation email from "bob@<test host name>" to href,
+// signed by key.
+func handleProof(t *testing.T, href string, key *rsa.PrivateKey) {
+	message := "From: Bob <bob@" + testHostname() + ">\r\n" +
+		"To: delegate@webfist.org\r\n" +
+		"Subject: WebFist delegation\r\n" +
+		"\r\n" +
+		"webfist = " + href + "\r\n"
+	signed, err := dkim.Sign([]byte(message), testHostname(), "test", key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wfMux.HandleFunc("/proof/bob", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "message/rfc822")
+		w.Write(signed)
 	})
+}
 
-	// simulate WebFist protocol
+// handleWebFist serves a WebFist JRD delegating to href, with a proof.
+func handleWebFist(t *testing.T, href string) {
 	wfMux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
 		resource := r.FormValue("resource")
 		if want := "acct:bob@" + testHost; resource != want {
@@ -52,10 +89,30 @@ func TestWebFistLookup(t *testing.T) {
 		fmt.Fprint(w, `{
 			"links": [{
 				"rel": "http://webfist.org/spec/rel",
-				"href": "`+server.URL+`/webfinger.json"
+				"href": "`+href+`",
+				"properties": {"http://webfist.org/spec/proof": "/proof/bob"}
 			}]
 		}`)
 	})
+}
+
+func webFistTearDown() {
+	teardown()
+	wfServer.Close()
+}
+
+func TestWebFistLookup(t *testing.T) {
+	webFistSetup()
+	defer webFistTearDown()
+
+	mux.HandleFunc("/webfinger.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	})
+
+	// simulate WebFist protocol
+	handleWebFist(t, server.URL+"/webfinger.json")
+	handleProof(t, server.URL+"/webfinger.json", wfKey)
 
 	JRD, err := client.Lookup("bob@"+testHost, nil)
 	if err != nil {
@@ -101,3 +158,141 @@ func TestWebFistLookup_invalidLink(t *testing.T) {
 		t.Errorf("Expected webfist error.")
 	}
 }
+
+func TestWebFistLookup_noProof(t *testing.T) {
+	webFistSetup()
+	defer webFistTearDown()
+
+	wfMux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{
+			"links": [{
+				"rel": "http://webfist.org/spec/rel",
+				"href": "`+server.URL+`/webfinger.json"
+			}]
+		}`)
+	})
+
+	_, err := client.Lookup("bob@"+testHost, nil)
+	if err == nil {
+		t.Errorf("Expected webfist error.")
+	}
+}
+
+func TestWebFistLookup_invalidProof(t *testing.T) {
+	webFistSetup()
+	defer webFistTearDown()
+
+	// proof signed with a key not published in DNS
+	other, _ := rsa.GenerateKey(rand.Reader, 1024)
+	handleWebFist(t, server.URL+"/webfinger.json")
+	handleProof(t, server.URL+"/webfinger.json", other)
+
+	_, err := client.Lookup("bob@"+testHost, nil)
+	var perr *webfist.ProofError
+	if !errors.As(err, &perr) {
+		t.Errorf("Lookup returned error %#v, want *webfist.ProofError", err)
+	}
+}
+
+func TestWebFistLookup_proofMismatch(t *testing.T) {
+	webFistSetup()
+	defer webFistTearDown()
+
+	// proof delegating to another URL
+	handleWebFist(t, server.URL+"/webfinger.json")
+	handleProof(t, server.URL+"/other.json", wfKey)
+
+	_, err := client.Lookup("bob@"+testHost, nil)
+	var perr *webfist.ProofError
+	if !errors.As(err, &perr) {
+		t.Errorf("Lookup returned error %#v, want *webfist.ProofError", err)
+	}
+}
+
+func TestWebFistLookup_schemePolicy(t *testing.T) {
+	webFistSetup()
+	defer webFistTearDown()
+
+	// delegation to a plain HTTP URL, while the client only allows HTTPS
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Unexpected request over HTTP: %s", r.URL)
+	}))
+	defer plain.Close()
+
+	client.SchemePolicy = HTTPSOnly
+	handleWebFist(t, plain.URL+"/webfinger.json")
+	handleProof(t, plain.URL+"/webfinger.json", wfKey)
+
+	_, err := client.Lookup("bob@"+testHost, nil)
+	if err == nil {
+		t.Errorf("Expected webfist error for an http delegation link.")
+	}
+}
+
+func TestWebFistLookup_multipleServers(t *testing.T) {
+	webFistSetup()
+	defer webFistTearDown()
+
+	mux.HandleFunc("/webfinger.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("content-type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"bob@example.com"}`)
+	})
+	handleWebFist(t, server.URL+"/webfinger.json")
+	handleProof(t, server.URL+"/webfinger.json", wfKey)
+
+	// a WebFist server without any delegation, and a slow one
+	empty := httptest.NewTLSServer(http.NotFoundHandler())
+	defer empty.Close()
+	emptyURL, _ := url.Parse(empty.URL)
+	slow := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer slow.Close()
+	slowURL, _ := url.Parse(slow.URL)
+
+	client.WebFistServers = []string{emptyURL.Host, slowURL.Host, wfTestHost}
+	client.WebFistTimeout = 50 * time.Millisecond
+
+	for _, parallel := range []bool{false, true} {
+		client.WebFistParallel = parallel
+		JRD, err := client.Lookup("bob@"+testHost, nil)
+		if err != nil {
+			t.Errorf("Unexpected error (parallel: %v): %v", parallel, err)
+			continue
+		}
+		if got, want := JRD.Subject, "bob@example.com"; got != want {
+			t.Errorf("Lookup returned subject %q (parallel: %v), want %q", got, parallel, want)
+		}
+	}
+
+	client.WebFistServers = []string{emptyURL.Host, slowURL.Host}
+	_, err := client.Lookup("bob@"+testHost, nil)
+	var wferr *WebFistError
+	if !errors.As(err, &wferr) {
+		t.Fatalf("Lookup returned error %#v, want *WebFistError", err)
+	}
+	if got, want := len(wferr.Errors), 2; got != want {
+		t.Errorf("WebFistError has %d errors, want %d", got, want)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Lookup returned error %v, want a timeout", err)
+	}
+}
+
+func TestWebFistLookup_disabled(t *testing.T) {
+	webFistSetup()
+	defer webFistTearDown()
+
+	wfMux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("WebFist server queried while disabled")
+	})
+
+	client.DisableWebFist = true
+	if _, err := client.Lookup("bob@"+testHost, nil); err == nil {
+		t.Error("Expected error")
+	}
+}